@@ -1,31 +1,211 @@
 package env
 
 import (
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"slices"
+	"reflect"
+	"strings"
 
 	"github.com/caarlos0/env/v11"
 	"github.com/joho/godotenv"
 )
 
+// Validator is implemented by settings that validate themselves after they are loaded,
+// e.g. to require a certificate path when TLS is enabled.
+type Validator interface {
+	Validate() error
+}
+
 // LoadSettings is a simple wrapper around godotenv.Load and env.Parse.
+// Files that do not exist are skipped, so services that only use real environment variables
+// can pass the same paths as in development. Malformed files return an error.
+// Settings can be read from files, such as mounted secrets, with variables ending with FileSuffix.
+// If the settings implement Validator, Validate is called after parsing and its error is returned.
 func LoadSettings[T any](filePaths ...string) (T, error) {
-	filePaths = slices.DeleteFunc(filePaths, func(file string) bool {
-		_, err := os.Stat(file)
-		return os.IsNotExist(err)
-	})
 	var settings T
-	if len(filePaths) > 0 {
-		err := godotenv.Load(filePaths...)
-		if err != nil {
-			return settings, fmt.Errorf("failed to load settings from %s: %w", filePaths, err)
-		}
+	if err := loadDotEnv(filePaths); err != nil {
+		return settings, err
 	}
 	// Then override with environment variables
-	if err := env.Parse(&settings); err != nil {
+	if err := parseSettings(&settings, ""); err != nil {
+		return settings, fmt.Errorf("failed to parse settings from environment variables: %w", err)
+	}
+	return settings, validateSettings(&settings)
+}
+
+// LoadSettingsWithPrefix is like LoadSettings but reads the environment variables with the given prefix,
+// e.g. with the prefix "API_" the field tagged env:"PORT" is read from API_PORT.
+// This allows multiple components in one binary to read their own settings from the same environment.
+// The prefix only applies to the environment variable parse step: keys in the dotenv files are loaded
+// as is, so they must include the prefix.
+func LoadSettingsWithPrefix[T any](prefix string, filePaths ...string) (T, error) {
+	var settings T
+	if err := loadDotEnv(filePaths); err != nil {
+		return settings, err
+	}
+	if err := parseSettings(&settings, prefix); err != nil {
+		return settings, fmt.Errorf("failed to parse settings from environment variables with prefix %s: %w", prefix, err)
+	}
+	return settings, validateSettings(&settings)
+}
+
+// LoadSettingsStrict is like LoadSettings but reports every missing or invalid environment variable at once.
+// Fields are required with the env "required" or "notEmpty" tag options.
+// The returned error lists the name of each offending environment variable and joins the underlying errors.
+func LoadSettingsStrict[T any](filePaths ...string) (T, error) {
+	var settings T
+	if err := loadDotEnv(filePaths); err != nil {
+		return settings, err
+	}
+	if err := parseSettings(&settings, ""); err != nil {
+		return settings, newSettingsError(reflect.TypeOf(settings), "", err)
+	}
+	return settings, validateSettings(&settings)
+}
+
+// LoadSettingsOverride is like LoadSettings but layers the dotenv files, e.g. a base .env and an .env.local.
+// The precedence, from highest to lowest, is:
+//  1. environment variables set in the process before the call
+//  2. the last file in filePaths
+//  3. earlier files in filePaths, in reverse order
+//
+// This follows godotenv.Overload semantics between the files, while godotenv.Load, used by LoadSettings,
+// keeps the first value set. Files that do not exist are skipped.
+func LoadSettingsOverride[T any](filePaths ...string) (T, error) {
+	var settings T
+	if err := overloadDotEnv(filePaths); err != nil {
+		return settings, err
+	}
+	if err := parseSettings(&settings, ""); err != nil {
 		return settings, fmt.Errorf("failed to parse settings from environment variables: %w", err)
 	}
+	return settings, validateSettings(&settings)
+}
+
+// validateSettings calls Validate if the settings implement Validator, with a value or a pointer receiver.
+func validateSettings(settings any) error {
+	validator, ok := settings.(Validator)
+	if !ok {
+		return nil
+	}
+	if err := validator.Validate(); err != nil {
+		return fmt.Errorf("invalid settings: %w", err)
+	}
+	return nil
+}
+
+// overloadDotEnv loads the dotenv files so later files override earlier ones, skipping files that do not exist.
+// Variables already set in the process environment are never overridden.
+func overloadDotEnv(filePaths []string) error {
+	values := map[string]string{}
+	for _, file := range filePaths {
+		fileValues, err := godotenv.Read(file)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to load settings from %s: %w", file, err)
+		}
+		for key, value := range fileValues {
+			values[key] = value
+		}
+	}
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return fmt.Errorf("failed to set %s: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// loadDotEnv loads the dotenv files, skipping files that do not exist.
+func loadDotEnv(filePaths []string) error {
+	for _, file := range filePaths {
+		if err := godotenv.Load(file); err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to load settings from %s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// newSettingsError aggregates the errors of env.Parse into a single error listing the missing and invalid variables.
+func newSettingsError(settingsType reflect.Type, prefix string, err error) error {
+	var aggErr env.AggregateError
+	if !errors.As(err, &aggErr) {
+		return fmt.Errorf("failed to parse settings from environment variables: %w", err)
+	}
+	keys := fieldEnvKeys(settingsType, prefix)
+	var missing, invalid []string
+	for _, e := range aggErr.Errors {
+		var notSetErr env.VarIsNotSetError
+		var emptyErr env.EmptyVarError
+		var parseErr env.ParseError
+		switch {
+		case errors.As(e, &notSetErr):
+			missing = append(missing, notSetErr.Key)
+		case errors.As(e, &emptyErr):
+			missing = append(missing, emptyErr.Key)
+		case errors.As(e, &parseErr):
+			key := parseErr.Name
+			if envKey, ok := keys[parseErr.Name]; ok {
+				key = envKey
+			}
+			invalid = append(invalid, key)
+		}
+	}
+	var sb strings.Builder
+	sb.WriteString("invalid settings")
+	if len(missing) > 0 {
+		sb.WriteString(", missing: " + strings.Join(missing, ", "))
+	}
+	if len(invalid) > 0 {
+		sb.WriteString(", invalid: " + strings.Join(invalid, ", "))
+	}
+	return fmt.Errorf("%s: %w", sb.String(), errors.Join(aggErr.Errors...))
+}
+
+// fieldEnvKeys maps the struct field names of settingsType to their environment variable names.
+func fieldEnvKeys(settingsType reflect.Type, prefix string) map[string]string {
+	keys := map[string]string{}
+	visitEnvKeys(settingsType, prefix, func(field, key string) {
+		keys[field] = key
+	})
+	return keys
+}
 
-	return settings, nil
+// visitEnvKeys calls fn with the name and the environment variable name of each field of settingsType,
+// following nested structs and their envPrefix tags.
+func visitEnvKeys(settingsType reflect.Type, prefix string, fn func(field, key string)) {
+	if settingsType.Kind() == reflect.Pointer {
+		settingsType = settingsType.Elem()
+	}
+	if settingsType.Kind() != reflect.Struct {
+		return
+	}
+	for i := range settingsType.NumField() {
+		field := settingsType.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if key == "" && fieldType.Kind() == reflect.Struct {
+			visitEnvKeys(fieldType, prefix+field.Tag.Get("envPrefix"), fn)
+			continue
+		}
+		if key != "" && key != "-" {
+			fn(field.Name, prefix+key)
+		}
+	}
 }
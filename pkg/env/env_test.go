@@ -0,0 +1,127 @@
+package env
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testSettings struct {
+	Port int    `env:"TEST_SETTINGS_PORT"`
+	Name string `env:"TEST_SETTINGS_NAME"`
+}
+
+func TestLoadSettingsMissingFile(t *testing.T) {
+	t.Setenv("TEST_SETTINGS_PORT", "8080")
+
+	settings, err := LoadSettings[testSettings](filepath.Join(t.TempDir(), "missing.env"))
+	require.NoError(t, err)
+	require.Equal(t, 8080, settings.Port)
+}
+
+func TestLoadSettingsPresentFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.env")
+	require.NoError(t, os.WriteFile(path, []byte("TEST_SETTINGS_PORT=9090\nTEST_SETTINGS_NAME=from-file\n"), 0o600))
+	// real environment variables take precedence over the file
+	t.Setenv("TEST_SETTINGS_NAME", "from-env")
+	t.Cleanup(func() { _ = os.Unsetenv("TEST_SETTINGS_PORT") })
+
+	settings, err := LoadSettings[testSettings](path)
+	require.NoError(t, err)
+	require.Equal(t, testSettings{Port: 9090, Name: "from-env"}, settings)
+}
+
+func TestLoadSettingsMalformedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "settings.env")
+	require.NoError(t, os.WriteFile(path, []byte("BAD-KEY=1\n"), 0o600))
+
+	_, err := LoadSettings[testSettings](path)
+	require.Error(t, err)
+}
+
+type strictSettings struct {
+	Port     int    `env:"STRICT_PORT,required"`
+	Name     string `env:"STRICT_NAME,required"`
+	Token    string `env:"STRICT_TOKEN,notEmpty"`
+	Database struct {
+		Timeout int `env:"TIMEOUT"`
+	} `envPrefix:"STRICT_DB_"`
+}
+
+func TestLoadSettingsStrict(t *testing.T) {
+	t.Setenv("STRICT_TOKEN", "")
+	t.Setenv("STRICT_DB_TIMEOUT", "soon")
+
+	_, err := LoadSettingsStrict[strictSettings]()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "missing: STRICT_PORT, STRICT_NAME, STRICT_TOKEN")
+	require.Contains(t, err.Error(), "invalid: STRICT_DB_TIMEOUT")
+
+	t.Setenv("STRICT_PORT", "8080")
+	t.Setenv("STRICT_NAME", "api")
+	t.Setenv("STRICT_TOKEN", "secret")
+	t.Setenv("STRICT_DB_TIMEOUT", "5")
+	settings, err := LoadSettingsStrict[strictSettings]()
+	require.NoError(t, err)
+	require.Equal(t, 8080, settings.Port)
+	require.Equal(t, 5, settings.Database.Timeout)
+}
+
+func TestLoadSettingsWithPrefix(t *testing.T) {
+	t.Setenv("INGEST_TEST_SETTINGS_PORT", "8081")
+	t.Setenv("INGEST_TEST_SETTINGS_NAME", "ingest")
+	t.Setenv("API_TEST_SETTINGS_PORT", "8082")
+	t.Setenv("API_TEST_SETTINGS_NAME", "api")
+
+	ingest, err := LoadSettingsWithPrefix[testSettings]("INGEST_")
+	require.NoError(t, err)
+	require.Equal(t, testSettings{Port: 8081, Name: "ingest"}, ingest)
+
+	api, err := LoadSettingsWithPrefix[testSettings]("API_")
+	require.NoError(t, err)
+	require.Equal(t, testSettings{Port: 8082, Name: "api"}, api)
+}
+
+func TestLoadSettingsOverride(t *testing.T) {
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	require.NoError(t, os.WriteFile(base, []byte("TEST_SETTINGS_PORT=8080\nTEST_SETTINGS_NAME=base\n"), 0o600))
+	require.NoError(t, os.WriteFile(local, []byte("TEST_SETTINGS_PORT=9090\nTEST_SETTINGS_NAME=local\n"), 0o600))
+	// real environment variables take precedence over all files
+	t.Setenv("TEST_SETTINGS_NAME", "from-env")
+	t.Cleanup(func() { _ = os.Unsetenv("TEST_SETTINGS_PORT") })
+
+	settings, err := LoadSettingsOverride[testSettings](base, local, filepath.Join(dir, "missing.env"))
+	require.NoError(t, err)
+	require.Equal(t, testSettings{Port: 9090, Name: "from-env"}, settings)
+}
+
+type validatedSettings struct {
+	TLSEnabled bool   `env:"VALIDATED_TLS_ENABLED"`
+	CertFile   string `env:"VALIDATED_CERT_FILE"`
+}
+
+var errCertFileRequired = errors.New("cert file is required when TLS is enabled")
+
+func (s *validatedSettings) Validate() error {
+	if s.TLSEnabled && s.CertFile == "" {
+		return errCertFileRequired
+	}
+	return nil
+}
+
+func TestLoadSettingsValidate(t *testing.T) {
+	t.Setenv("VALIDATED_TLS_ENABLED", "true")
+
+	_, err := LoadSettings[validatedSettings]()
+	require.ErrorIs(t, err, errCertFileRequired)
+
+	t.Setenv("VALIDATED_CERT_FILE", "/etc/tls/cert.pem")
+	settings, err := LoadSettings[validatedSettings]()
+	require.NoError(t, err)
+	require.Equal(t, validatedSettings{TLSEnabled: true, CertFile: "/etc/tls/cert.pem"}, settings)
+}
@@ -0,0 +1,55 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// FeatureFlagPrefix is the prefix of environment variables that are parsed as feature flags.
+const FeatureFlagPrefix = "FEATURE_"
+
+// FeatureFlags is a set of feature flags keyed by the upper case flag name without the FeatureFlagPrefix.
+// The zero value has all features disabled.
+type FeatureFlags map[string]bool
+
+// Enabled reports whether the feature is enabled. Unset features are disabled.
+// The name is case-insensitive and may use dashes instead of underscores, e.g. "new-search" matches FEATURE_NEW_SEARCH.
+func (f FeatureFlags) Enabled(name string) bool {
+	return f[normalizeFeatureName(name)]
+}
+
+// LoadFeatureFlags parses the feature flags from the environment variables.
+// Call it after LoadSettings so flags set in the settings files are included.
+func LoadFeatureFlags() (FeatureFlags, error) {
+	return ParseFeatureFlags(os.Environ())
+}
+
+// ParseFeatureFlags parses FEATURE_X=true style variables from environ, a list of KEY=value pairs as returned by os.Environ.
+// Values are parsed with strconv.ParseBool, an empty value disables the feature.
+func ParseFeatureFlags(environ []string) (FeatureFlags, error) {
+	flags := FeatureFlags{}
+	for _, kv := range environ {
+		key, value, _ := strings.Cut(kv, "=")
+		name, ok := strings.CutPrefix(key, FeatureFlagPrefix)
+		if !ok || name == "" {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if value == "" {
+			flags[normalizeFeatureName(name)] = false
+			continue
+		}
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse feature flag %s: %w", key, err)
+		}
+		flags[normalizeFeatureName(name)] = enabled
+	}
+	return flags, nil
+}
+
+func normalizeFeatureName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
@@ -0,0 +1,39 @@
+package env
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeatureFlags(t *testing.T) {
+	flags, err := ParseFeatureFlags([]string{
+		"FEATURE_NEW_SEARCH=true",
+		"FEATURE_LEGACY_API=0",
+		"FEATURE_BETA=",
+		"PORT=8080",
+	})
+	require.NoError(t, err)
+	require.Equal(t, FeatureFlags{"NEW_SEARCH": true, "LEGACY_API": false, "BETA": false}, flags)
+
+	_, err = ParseFeatureFlags([]string{"FEATURE_NEW_SEARCH=yes"})
+	require.Error(t, err)
+}
+
+func TestFeatureFlagsEnabled(t *testing.T) {
+	flags := FeatureFlags{"NEW_SEARCH": true, "LEGACY_API": false}
+	require.True(t, flags.Enabled("NEW_SEARCH"))
+	require.True(t, flags.Enabled("new-search"))
+	require.False(t, flags.Enabled("LEGACY_API"))
+	require.False(t, flags.Enabled("UNSET"))
+
+	var empty FeatureFlags
+	require.False(t, empty.Enabled("NEW_SEARCH"))
+}
+
+func TestLoadFeatureFlags(t *testing.T) {
+	t.Setenv("FEATURE_FROM_ENV", "true")
+	flags, err := LoadFeatureFlags()
+	require.NoError(t, err)
+	require.True(t, flags.Enabled("from_env"))
+}
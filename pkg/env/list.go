@@ -0,0 +1,59 @@
+package env
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// ParseList parses a comma separated list with parse, e.g. the value of an environment variable.
+// Entries are trimmed and empty entries are skipped, so an empty value returns an empty slice.
+// Every malformed entry is reported, the returned error joins the errors of all of them.
+func ParseList[T any](envVal string, parse func(string) (T, error)) ([]T, error) {
+	var values []T
+	var errs []error
+	for i, entry := range strings.Split(envVal, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		value, err := parse(entry)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid entry %d %q: %w", i, entry, err))
+			continue
+		}
+		values = append(values, value)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return values, nil
+}
+
+// ParseAddresses parses a comma separated list of hex encoded addresses, e.g. a contract allowlist.
+func ParseAddresses(envVal string) ([]common.Address, error) {
+	return ParseList(envVal, parseAddress)
+}
+
+// ParseBigInts parses a comma separated list of base 10 integers, e.g. token ids.
+func ParseBigInts(envVal string) ([]*big.Int, error) {
+	return ParseList(envVal, parseBigInt)
+}
+
+func parseAddress(s string) (common.Address, error) {
+	if !common.IsHexAddress(s) {
+		return common.Address{}, errors.New("not a hex address")
+	}
+	return common.HexToAddress(s), nil
+}
+
+func parseBigInt(s string) (*big.Int, error) {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return nil, errors.New("not a base 10 integer")
+	}
+	return n, nil
+}
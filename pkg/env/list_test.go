@@ -0,0 +1,39 @@
+package env
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAddresses(t *testing.T) {
+	addrs, err := ParseAddresses(" 0xbA5738a18d83D41847dfFbDC6101d37C69c9B0cF, ,0x45fbcd3ef7361d156e8b16f5538ae36dedf61da8")
+	require.NoError(t, err)
+	require.Equal(t, []common.Address{
+		common.HexToAddress("0xbA5738a18d83D41847dfFbDC6101d37C69c9B0cF"),
+		common.HexToAddress("0x45fbcd3ef7361d156e8b16f5538ae36dedf61da8"),
+	}, addrs)
+
+	addrs, err = ParseAddresses("")
+	require.NoError(t, err)
+	require.Empty(t, addrs)
+
+	_, err = ParseAddresses("0xbA5738a18d83D41847dfFbDC6101d37C69c9B0cF,0x123,not-an-address")
+	require.Error(t, err)
+	require.ErrorContains(t, err, `invalid entry 1 "0x123"`)
+	require.ErrorContains(t, err, `invalid entry 2 "not-an-address"`)
+}
+
+func TestParseBigInts(t *testing.T) {
+	ids, err := ParseBigInts("1, 42,115792089237316195423570985008687907853269984665640564039457584007913129639935")
+	require.NoError(t, err)
+	maxUint256, _ := new(big.Int).SetString("115792089237316195423570985008687907853269984665640564039457584007913129639935", 10)
+	require.Equal(t, []*big.Int{big.NewInt(1), big.NewInt(42), maxUint256}, ids)
+
+	_, err = ParseBigInts("1,0x2,abc")
+	require.Error(t, err)
+	require.ErrorContains(t, err, `invalid entry 1 "0x2"`)
+	require.ErrorContains(t, err, `invalid entry 2 "abc"`)
+}
@@ -0,0 +1,52 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/caarlos0/env/v11"
+)
+
+// FileSuffix is the suffix of environment variables that hold the path of a file with the value of a setting,
+// e.g. DB_PASSWORD_FILE=/run/secrets/db sets the field tagged env:"DB_PASSWORD" to the content of /run/secrets/db.
+// This is how secrets are usually mounted in Kubernetes and Docker, and keeps them out of the environment.
+// Only variables of fields of the settings struct are read from files, other variables ending with the suffix
+// are left alone. A value set inline takes precedence over the file.
+const FileSuffix = "_FILE"
+
+// fileEnvironment returns the process environment with the values of the settings fields that are set with a
+// FileSuffix variable read from their files. Trailing newlines of the files are trimmed.
+// The process environment is not modified.
+func fileEnvironment(settingsType reflect.Type, prefix string) (map[string]string, error) {
+	environment := env.ToMap(os.Environ())
+	var keys []string
+	visitEnvKeys(settingsType, prefix, func(_, key string) {
+		keys = append(keys, key)
+	})
+	for _, key := range keys {
+		if _, ok := environment[key]; ok {
+			continue
+		}
+		path := environment[key+FileSuffix]
+		if path == "" {
+			continue
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s from %s: %w", key, key+FileSuffix, err)
+		}
+		environment[key] = strings.TrimRight(string(content), "\r\n")
+	}
+	return environment, nil
+}
+
+// parseSettings parses the settings from the environment, resolving FileSuffix variables first.
+func parseSettings[T any](settings *T, prefix string) error {
+	environment, err := fileEnvironment(reflect.TypeOf(settings), prefix)
+	if err != nil {
+		return err
+	}
+	return env.ParseWithOptions(settings, env.Options{Prefix: prefix, Environment: environment})
+}
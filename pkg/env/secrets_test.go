@@ -0,0 +1,51 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type secretSettings struct {
+	Password string `env:"SECRET_DB_PASSWORD"`
+	Redis    struct {
+		Password string `env:"PASSWORD"`
+	} `envPrefix:"SECRET_REDIS_"`
+	LogFile string `env:"SECRET_LOG_FILE"`
+}
+
+func TestLoadSettingsFromFile(t *testing.T) {
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "db")
+	require.NoError(t, os.WriteFile(dbPath, []byte("db-secret\n"), 0o600))
+	redisPath := filepath.Join(dir, "redis")
+	require.NoError(t, os.WriteFile(redisPath, []byte("redis-secret"), 0o600))
+	t.Setenv("SECRET_DB_PASSWORD_FILE", dbPath)
+	t.Setenv("SECRET_REDIS_PASSWORD_FILE", redisPath)
+	// variables of fields that end with the suffix are not read from files
+	t.Setenv("SECRET_LOG_FILE", filepath.Join(dir, "missing.log"))
+
+	settings, err := LoadSettings[secretSettings]()
+	require.NoError(t, err)
+	require.Equal(t, "db-secret", settings.Password)
+	require.Equal(t, "redis-secret", settings.Redis.Password)
+	require.Equal(t, filepath.Join(dir, "missing.log"), settings.LogFile)
+	// the secrets are not added to the environment
+	_, ok := os.LookupEnv("SECRET_DB_PASSWORD")
+	require.False(t, ok)
+
+	// a value set inline takes precedence over the file
+	t.Setenv("SECRET_DB_PASSWORD", "inline")
+	settings, err = LoadSettings[secretSettings]()
+	require.NoError(t, err)
+	require.Equal(t, "inline", settings.Password)
+}
+
+func TestLoadSettingsFromMissingFile(t *testing.T) {
+	t.Setenv("SECRET_DB_PASSWORD_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	_, err := LoadSettings[secretSettings]()
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,64 @@
+package fibercommon
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+// AccessLogConfig configures the middleware created by NewAccessLogMiddleware.
+type AccessLogConfig struct {
+	// LevelFunc returns the log level for the response status code.
+	// Defaults to info for 1xx-3xx, warn for 4xx and error for 5xx status codes.
+	LevelFunc func(status int) zerolog.Level
+}
+
+// AccessLogMiddleware logs a line per request with the status code, latency and response size.
+// It logs through the user context logger so it inherits the fields added by ContextLoggerMiddleware
+// and should be registered after it.
+func AccessLogMiddleware(c *fiber.Ctx) error {
+	return accessLog(c, AccessLogConfig{})
+}
+
+// NewAccessLogMiddleware creates an AccessLogMiddleware with the given configuration.
+func NewAccessLogMiddleware(cfg AccessLogConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return accessLog(c, cfg)
+	}
+}
+
+func accessLog(c *fiber.Ctx, cfg AccessLogConfig) error {
+	start := time.Now()
+	if err := c.Next(); err != nil {
+		// errors are converted to a response by the error handler after the middleware chain returns,
+		// so it is called here to log the final status code, like the fiber logger middleware does.
+		if handlerErr := c.App().ErrorHandler(c, err); handlerErr != nil {
+			_ = c.SendStatus(fiber.StatusInternalServerError)
+		}
+	}
+	latency := time.Since(start)
+
+	status := c.Response().StatusCode()
+	levelFunc := cfg.LevelFunc
+	if levelFunc == nil {
+		levelFunc = defaultAccessLogLevel
+	}
+	zerolog.Ctx(c.UserContext()).WithLevel(levelFunc(status)).
+		Int("httpStatusCode", status).
+		Dur("duration", latency).
+		Int("responseBytes", len(c.Response().Body())).
+		Msg("http request completed")
+	return nil
+}
+
+func defaultAccessLogLevel(status int) zerolog.Level {
+	switch {
+	case status >= fiber.StatusInternalServerError:
+		return zerolog.ErrorLevel
+	case status >= fiber.StatusBadRequest:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.InfoLevel
+	}
+}
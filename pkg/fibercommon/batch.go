@@ -0,0 +1,39 @@
+package fibercommon
+
+import "github.com/gofiber/fiber/v2"
+
+// BatchResponse is the response envelope of batch endpoints that can partially succeed.
+type BatchResponse struct {
+	Results []BatchItemResult `json:"results"`
+}
+
+// BatchItemResult is the result of a single item of a batch request.
+type BatchItemResult struct {
+	ID     string         `json:"id"`
+	Status int            `json:"status"`
+	Error  *CodedResponse `json:"error,omitempty"`
+}
+
+// BatchItemSuccess creates a successful BatchItemResult with the given status code.
+func BatchItemSuccess(id string, status int) BatchItemResult {
+	return BatchItemResult{ID: id, Status: status}
+}
+
+// BatchItemError creates a failed BatchItemResult from err using the same code and message as the ErrorHandler,
+// so only the external message of a rich error is returned to the client.
+func BatchItemError(id string, err error) BatchItemResult {
+	resp := codedResponseOf(err)
+	return BatchItemResult{
+		ID:     id,
+		Status: resp.Code,
+		Error:  &resp,
+	}
+}
+
+// SendBatchResponse sends the results in a BatchResponse with a 207 Multi-Status status code.
+func SendBatchResponse(c *fiber.Ctx, results []BatchItemResult) error {
+	if results == nil {
+		results = []BatchItemResult{}
+	}
+	return c.Status(fiber.StatusMultiStatus).JSON(BatchResponse{Results: results})
+}
@@ -0,0 +1,64 @@
+package fibercommon
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CacheOption configures SetCacheControl.
+type CacheOption func(*cacheConfig)
+
+type cacheConfig struct {
+	private bool
+	vary    []string
+}
+
+// WithPrivateCache allows authenticated responses to be stored in private caches, such as the browser cache.
+// By default authenticated responses are sent with no-store.
+func WithPrivateCache() CacheOption {
+	return func(c *cacheConfig) {
+		c.private = true
+	}
+}
+
+// WithVary adds the given request headers to the Vary header.
+func WithVary(headers ...string) CacheOption {
+	return func(c *cacheConfig) {
+		c.vary = append(c.vary, headers...)
+	}
+}
+
+// SetCacheControl sets the Cache-Control, Expires and Vary headers of the response.
+// Unauthenticated responses are cacheable by shared caches for maxAge.
+// Responses to requests with an Authorization header are sent with no-store so tokenized responses are never cached,
+// unless WithPrivateCache is used, in which case they are cacheable by private caches only and vary by Authorization.
+// A maxAge of zero or less also sends no-store.
+func SetCacheControl(c *fiber.Ctx, maxAge time.Duration, opts ...CacheOption) {
+	cfg := &cacheConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	authenticated := c.Get(fiber.HeaderAuthorization) != ""
+	vary := cfg.vary
+	switch {
+	case maxAge <= 0 || (authenticated && !cfg.private):
+		c.Set(fiber.HeaderCacheControl, "no-store")
+		c.Set(fiber.HeaderExpires, "0")
+	default:
+		scope := "public"
+		if authenticated {
+			scope = "private"
+			vary = append(vary, fiber.HeaderAuthorization)
+		}
+		seconds := int(maxAge / time.Second)
+		c.Set(fiber.HeaderCacheControl, scope+", max-age="+strconv.Itoa(seconds))
+		c.Set(fiber.HeaderExpires, time.Now().Add(maxAge).UTC().Format(http.TimeFormat))
+	}
+	if len(vary) > 0 {
+		c.Set(fiber.HeaderVary, strings.Join(vary, ", "))
+	}
+}
@@ -0,0 +1,87 @@
+package fibercommon
+
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+)
+
+// defaultCORSMaxAge is how long browsers cache the result of a preflight request by default.
+const defaultCORSMaxAge = time.Hour
+
+var (
+	defaultCORSAllowHeaders = []string{
+		fiber.HeaderOrigin,
+		fiber.HeaderContentType,
+		fiber.HeaderAccept,
+		fiber.HeaderAuthorization,
+		HeaderRequestID,
+	}
+	defaultCORSAllowMethods = []string{
+		fiber.MethodGet,
+		fiber.MethodPost,
+		fiber.MethodHead,
+		fiber.MethodPut,
+		fiber.MethodDelete,
+		fiber.MethodPatch,
+		fiber.MethodOptions,
+	}
+	defaultCORSExposeHeaders = []string{
+		HeaderRequestID,
+		fiber.HeaderRetryAfter,
+	}
+)
+
+// CORSConfig overrides the defaults of the middleware created by NewCORSWithConfig.
+// Empty fields use the defaults.
+type CORSConfig struct {
+	// AllowHeaders are the request headers allowed in cross origin requests.
+	// Defaults to Origin, Content-Type, Accept, Authorization and X-Request-ID.
+	AllowHeaders []string
+	// AllowMethods are the methods allowed in cross origin requests.
+	// Defaults to GET, POST, HEAD, PUT, DELETE, PATCH and OPTIONS.
+	AllowMethods []string
+	// ExposeHeaders are the response headers readable by the client. Defaults to X-Request-ID and Retry-After.
+	ExposeHeaders []string
+	// AllowCredentials allows cookies and other credentials in cross origin requests.
+	// It can not be used with the wildcard origin. Disabled by default, as tokens are sent in the Authorization header.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache the result of a preflight request. Defaults to one hour.
+	MaxAge time.Duration
+}
+
+// NewCORS creates a CORS middleware for the allowed origins with the DIMO defaults, see CORSConfig.
+// If allowedOrigins is empty, all origins are allowed.
+func NewCORS(allowedOrigins []string) fiber.Handler {
+	return NewCORSWithConfig(allowedOrigins, CORSConfig{})
+}
+
+// NewCORSWithConfig creates a CORS middleware for the allowed origins with the given configuration.
+func NewCORSWithConfig(allowedOrigins []string, cfg CORSConfig) fiber.Handler {
+	origins := "*"
+	if len(allowedOrigins) > 0 {
+		origins = strings.Join(allowedOrigins, ",")
+	}
+	maxAge := cfg.MaxAge
+	if maxAge == 0 {
+		maxAge = defaultCORSMaxAge
+	}
+	return cors.New(cors.Config{
+		AllowOrigins:     origins,
+		AllowHeaders:     strings.Join(orDefault(cfg.AllowHeaders, defaultCORSAllowHeaders), ","),
+		AllowMethods:     strings.Join(orDefault(cfg.AllowMethods, defaultCORSAllowMethods), ","),
+		ExposeHeaders:    strings.Join(orDefault(cfg.ExposeHeaders, defaultCORSExposeHeaders), ","),
+		AllowCredentials: cfg.AllowCredentials,
+		MaxAge:           int(maxAge.Seconds()),
+	})
+}
+
+// orDefault returns values, or defaults if values is empty.
+func orDefault(values, defaults []string) []string {
+	if len(values) == 0 {
+		return defaults
+	}
+	return values
+}
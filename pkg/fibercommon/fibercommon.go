@@ -4,8 +4,12 @@ package fibercommon
 import (
 	"context"
 	"errors"
+	"math"
+	"net/netip"
+	"strconv"
 	"strings"
 
+	"github.com/DIMO-Network/server-garage/pkg/logging"
 	"github.com/DIMO-Network/server-garage/pkg/richerrors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/rs/zerolog"
@@ -13,65 +17,155 @@ import (
 
 const defaultErrorMessage = "Internal error"
 
+// ContextLoggerConfig configures the middleware created by NewContextLoggerMiddleware.
+type ContextLoggerConfig struct {
+	// LogSourceIPFrom adds the origin of the source IP to the logger as sourceIpFrom.
+	LogSourceIPFrom bool
+	// AllowPrivateForwardedIP uses the left-most X-Forwarded-For entry even if it is a private address.
+	// By default the left-most public entry is used.
+	AllowPrivateForwardedIP bool
+	// TrustedProxies are the ranges of proxies whose forwarded headers are honored, see ParseTrustedProxies.
+	// When the immediate peer is not in one of the ranges the remote address is used as the source IP.
+	// If empty, forwarded headers are honored from all peers.
+	TrustedProxies []netip.Prefix
+	// SkipPaths are paths, such as /metrics or /health, that are not enriched with the http metadata.
+	// A path also matches all of its sub paths. Info level logs of downstream handlers, such as access logs,
+	// are dropped for skipped paths while warnings and errors are still logged.
+	// If empty, all paths are enriched.
+	SkipPaths []string
+	// KeepLeadingSlash logs httpPath as is. By default the leading slash is trimmed from the path.
+	KeepLeadingSlash bool
+}
+
 // ContextLoggerMiddleware adds the http metadata to the logger and adds the logger to the context.
 func ContextLoggerMiddleware(c *fiber.Ctx) error {
+	return contextLogger(c, ContextLoggerConfig{})
+}
+
+// NewContextLoggerMiddleware creates a ContextLoggerMiddleware with the given configuration.
+func NewContextLoggerMiddleware(cfg ContextLoggerConfig) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return contextLogger(c, cfg)
+	}
+}
+
+func contextLogger(c *fiber.Ctx, cfg ContextLoggerConfig) error {
 	ctx := c.UserContext()
 	if ctx == context.Background() {
 		// if the context is background, use the context from the request so we can get deadlines and cancellation signals
 		ctx = c.Context()
 	}
-	newCtx := zerolog.Ctx(ctx).With().
+	if isSkippedPath(c.Path(), cfg.SkipPaths) {
+		logger := zerolog.Ctx(ctx).Level(zerolog.WarnLevel)
+		c.SetUserContext(logger.WithContext(ctx))
+		return c.Next()
+	}
+	sourceIP, sourceIPFrom := getSourceIP(c, cfg)
+	path := c.Path()
+	if !cfg.KeepLeadingSlash {
+		path = strings.TrimPrefix(path, "/")
+	}
+	logCtx := zerolog.Ctx(ctx).With().
 		Str("httpMethod", c.Method()).
-		Str("httpPath", strings.TrimPrefix(c.Path(), "/")).
-		Str("sourceIp", getSourceIP(c)).
-		Logger().
-		WithContext(ctx)
+		Str("httpPath", path).
+		Str("sourceIp", sourceIP)
+	if cfg.LogSourceIPFrom {
+		logCtx = logCtx.Str("sourceIpFrom", sourceIPFrom)
+	}
+	newCtx := logCtx.Logger().WithContext(ctx)
 	c.SetUserContext(newCtx)
 	return c.Next()
 }
 
-func getSourceIP(c *fiber.Ctx) string {
-	sourceIP := c.Get("X-Forwarded-For")
-	if sourceIP == "" {
-		sourceIP = c.Get("X-Real-IP")
-	}
-	if sourceIP == "" {
-		sourceIP = c.IP()
+// isSkippedPath reports whether path is one of skipPaths or a sub path of one of them.
+func isSkippedPath(path string, skipPaths []string) bool {
+	for _, skipPath := range skipPaths {
+		skipPath = strings.TrimSuffix(skipPath, "/")
+		if path == skipPath || strings.HasPrefix(path, skipPath+"/") {
+			return true
+		}
 	}
-	return sourceIP
+	return false
+}
+
+// ErrorHandlerConfig configures the handler created by NewErrorHandler.
+type ErrorHandlerConfig struct {
+	// LogErrorCauses adds a causes array with the message of each error in the chain to the error log.
+	LogErrorCauses bool
 }
 
 // ErrorHandler is a custom handler to log recovered errors using our logger and return json instead of string.
 // This handler is aware of the richerrors package and will use the code and message from the error if available.
+// Clients that prefer plain text over JSON in their Accept header, e.g. Accept: text/plain, get only the message.
 // It will also log the error to the set in the user context logger.
 func ErrorHandler(ctx *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError // Default 500 statuscode
-	message := defaultErrorMessage
+	return handleError(ctx, err, ErrorHandlerConfig{})
+}
 
-	var fiberErr *fiber.Error
-	var richErr richerrors.Error
-	if errors.As(err, &fiberErr) {
-		code = fiberErr.Code
-		message = fiberErr.Message
-	} else if errors.As(err, &richErr) {
-		message = richErr.ExternalMsg
-		if richErr.Code != 0 {
-			code = richErr.Code
-		}
+// NewErrorHandler creates an ErrorHandler with the given configuration.
+func NewErrorHandler(cfg ErrorHandlerConfig) fiber.ErrorHandler {
+	return func(ctx *fiber.Ctx, err error) error {
+		return handleError(ctx, err, cfg)
+	}
+}
+
+func handleError(ctx *fiber.Ctx, err error, cfg ErrorHandlerConfig) error {
+	resp := codedResponseOf(err)
+	code := resp.Code
+	richErr, isRichErr := richerrors.AsRichError(err)
+	if errors.As(err, new(*fiber.Error)) {
+		isRichErr = false
+	}
+	if retryAfter, ok := richerrors.RetryAfterOf(err); ok {
+		ctx.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
 	}
 
 	// log all errors except non custom 404 messages
-	if code != fiber.StatusNotFound || message != defaultErrorMessage {
+	if code != fiber.StatusNotFound || resp.Message != defaultErrorMessage {
 		logger := zerolog.Ctx(ctx.UserContext())
-		logger.Err(err).Int("httpStatusCode", code).
-			Msg("caught an error from http request")
+		event := logger.Err(err).Int("httpStatusCode", code)
+		if isRichErr {
+			event = event.Str("errorDetail", richErr.DetailedString())
+		}
+		if cfg.LogErrorCauses {
+			event = event.Strs("causes", logging.ErrorCauses(err))
+		}
+		event.Msg("caught an error from http request")
 	}
 
-	return ctx.Status(code).JSON(CodedResponse{Code: code, Message: message})
+	if ctx.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextPlain) == fiber.MIMETextPlain {
+		return ctx.Status(code).SendString(resp.Message)
+	}
+	return ctx.Status(code).JSON(resp)
+}
+
+// codedResponseOf returns the CodedResponse returned to the client for err.
+// The response is derived from richerrors.ResponseOf, which is shared with the gRPC mapping so both protocols
+// return the same code and message. Only the external message of a rich error is returned to the client.
+func codedResponseOf(err error) CodedResponse {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		return CodedResponse{Code: fiberErr.Code, Message: fiberErr.Message}
+	}
+	resp := richerrors.ResponseOf(err, defaultErrorMessage)
+	return CodedResponse{
+		Code:      resp.HTTPStatus,
+		Message:   resp.Message,
+		ErrorCode: resp.ErrorCode,
+		Details:   resp.Details,
+		Fields:    resp.Fields,
+	}
 }
 
 // CodedResponse is a response that includes a code and a message.
 type CodedResponse struct {
 	Message string `json:"message"`
 	Code    int    `json:"code"`
+	// ErrorCode is the machine-readable code of a rich error, such as NOT_FOUND. It is omitted when not set.
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Details are per item messages, such as field validation errors, of a client error that joins multiple errors.
+	// They are omitted when not set.
+	Details []string `json:"details,omitempty"`
+	// Fields are the per-field validation messages of a client error keyed by field name. They are omitted when not set.
+	Fields map[string]string `json:"validation,omitempty"`
 }
@@ -0,0 +1,983 @@
+package fibercommon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/server-garage/pkg/fibercommon/jwtmiddleware"
+	"github.com/DIMO-Network/server-garage/pkg/health"
+	"github.com/DIMO-Network/server-garage/pkg/monserver"
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
+	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+)
+
+// newLoggedApp creates a fiber app with a buffered logger in the user context and the given middleware.
+func newLoggedApp(buf *bytes.Buffer, middleware fiber.Handler) *fiber.App {
+	logger := zerolog.New(buf)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(logger.WithContext(context.Background()))
+		return c.Next()
+	})
+	app.Use(middleware)
+	app.Get("/", func(c *fiber.Ctx) error {
+		zerolog.Ctx(c.UserContext()).Info().Msg("handled")
+		return c.SendStatus(fiber.StatusOK)
+	})
+	return app
+}
+
+func lastLogLine(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(lines[len(lines)-1], &entry))
+	return entry
+}
+
+func TestContextLoggerSourceIP(t *testing.T) {
+	tests := []struct {
+		name         string
+		cfg          ContextLoggerConfig
+		headers      map[string]string
+		expectedIP   string
+		expectedFrom string
+	}{
+		{
+			name:         "single forwarded for",
+			headers:      map[string]string{"X-Forwarded-For": "203.0.113.7"},
+			expectedIP:   "203.0.113.7",
+			expectedFrom: SourceIPFromForwardedFor,
+		},
+		{
+			name:         "forwarded for list skips private entries",
+			headers:      map[string]string{"X-Forwarded-For": "10.0.0.1, 192.168.1.1, 203.0.113.7, 198.51.100.2"},
+			expectedIP:   "203.0.113.7",
+			expectedFrom: SourceIPFromForwardedFor,
+		},
+		{
+			name:         "forwarded for list with private allowed",
+			cfg:          ContextLoggerConfig{AllowPrivateForwardedIP: true},
+			headers:      map[string]string{"X-Forwarded-For": "10.0.0.1, 203.0.113.7"},
+			expectedIP:   "10.0.0.1",
+			expectedFrom: SourceIPFromForwardedFor,
+		},
+		{
+			name:         "forwarded for list with only private entries",
+			headers:      map[string]string{"X-Forwarded-For": "10.0.0.1, 127.0.0.1"},
+			expectedIP:   "10.0.0.1",
+			expectedFrom: SourceIPFromForwardedFor,
+		},
+		{
+			name:         "invalid forwarded for falls back to real ip",
+			headers:      map[string]string{"X-Forwarded-For": "unknown", "X-Real-IP": "203.0.113.9"},
+			expectedIP:   "203.0.113.9",
+			expectedFrom: SourceIPFromRealIP,
+		},
+		{
+			name:         "invalid real ip uses remote address",
+			headers:      map[string]string{"X-Real-IP": "203.0.113.9, 198.51.100.2"},
+			expectedIP:   "0.0.0.0",
+			expectedFrom: SourceIPFromRemoteAddr,
+		},
+		{
+			name:         "no headers uses remote address",
+			expectedIP:   "0.0.0.0",
+			expectedFrom: SourceIPFromRemoteAddr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.cfg.LogSourceIPFrom = true
+			app := newLoggedApp(&buf, NewContextLoggerMiddleware(tt.cfg))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+
+			entry := lastLogLine(t, &buf)
+			require.Equal(t, tt.expectedIP, entry["sourceIp"])
+			require.Equal(t, tt.expectedFrom, entry["sourceIpFrom"])
+		})
+	}
+}
+
+func TestContextLoggerMiddlewareOmitsSourceIPFrom(t *testing.T) {
+	var buf bytes.Buffer
+	app := newLoggedApp(&buf, ContextLoggerMiddleware)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	_, err := app.Test(req)
+	require.NoError(t, err)
+
+	entry := lastLogLine(t, &buf)
+	require.Equal(t, "203.0.113.7", entry["sourceIp"])
+	require.NotContains(t, entry, "sourceIpFrom")
+}
+
+func TestErrorHandlerRedactsRichError(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(logger.WithContext(context.Background()))
+		return c.Next()
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return richerrors.ErrorWithCodef(fiber.StatusNotFound, "vehicle not found", "database query failed: user_id=%d not found", 123)
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+
+	var body CodedResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, "vehicle not found", body.Message)
+
+	entry := lastLogLine(t, &buf)
+	require.Contains(t, entry["errorDetail"], "user_id=123")
+}
+
+func TestContextLoggerTrustedProxies(t *testing.T) {
+	tests := []struct {
+		name         string
+		proxies      []string
+		header       string
+		value        string
+		expectedIP   string
+		expectedFrom string
+	}{
+		{
+			name:         "trusted peer",
+			proxies:      []string{"0.0.0.0"},
+			header:       "X-Forwarded-For",
+			value:        "203.0.113.7",
+			expectedIP:   "203.0.113.7",
+			expectedFrom: SourceIPFromForwardedFor,
+		},
+		{
+			name:         "trusted peer uses left-most forwarded entry",
+			proxies:      []string{"0.0.0.0"},
+			header:       "X-Forwarded-For",
+			value:        "203.0.113.7, 198.51.100.1",
+			expectedIP:   "203.0.113.7",
+			expectedFrom: SourceIPFromForwardedFor,
+		},
+		{
+			name:         "untrusted peer",
+			proxies:      []string{"10.0.0.0/8", "192.168.0.0/16"},
+			header:       "X-Forwarded-For",
+			value:        "203.0.113.7",
+			expectedIP:   "0.0.0.0",
+			expectedFrom: SourceIPFromRemoteAddr,
+		},
+		{
+			name:         "trusted peer real ip",
+			proxies:      []string{"0.0.0.0"},
+			header:       "X-Real-IP",
+			value:        "203.0.113.7",
+			expectedIP:   "203.0.113.7",
+			expectedFrom: SourceIPFromRealIP,
+		},
+		{
+			name:         "untrusted peer spoofed real ip",
+			proxies:      []string{"10.0.0.0/8"},
+			header:       "X-Real-IP",
+			value:        "203.0.113.7",
+			expectedIP:   "0.0.0.0",
+			expectedFrom: SourceIPFromRemoteAddr,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			trustedProxies, err := ParseTrustedProxies(tt.proxies)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			app := newLoggedApp(&buf, NewContextLoggerMiddleware(ContextLoggerConfig{
+				LogSourceIPFrom: true,
+				TrustedProxies:  trustedProxies,
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(tt.header, tt.value)
+			_, err = app.Test(req)
+			require.NoError(t, err)
+
+			entry := lastLogLine(t, &buf)
+			require.Equal(t, tt.expectedIP, entry["sourceIp"])
+			require.Equal(t, tt.expectedFrom, entry["sourceIpFrom"])
+		})
+	}
+}
+
+func TestParseTrustedProxies(t *testing.T) {
+	prefixes, err := ParseTrustedProxies([]string{"10.1.2.3/8", " 192.168.1.1 ", "", "::1"})
+	require.NoError(t, err)
+	require.Len(t, prefixes, 3)
+	require.Equal(t, "10.0.0.0/8", prefixes[0].String())
+	require.Equal(t, "192.168.1.1/32", prefixes[1].String())
+	require.Equal(t, "::1/128", prefixes[2].String())
+
+	_, err = ParseTrustedProxies([]string{"not-an-ip"})
+	require.Error(t, err)
+}
+
+func TestErrorHandlerLogsCauses(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	app := fiber.New(fiber.Config{ErrorHandler: NewErrorHandler(ErrorHandlerConfig{LogErrorCauses: true})})
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(logger.WithContext(context.Background()))
+		return c.Next()
+	})
+	app.Get("/", func(c *fiber.Ctx) error {
+		rootErr := errors.New("connection refused")
+		return fmt.Errorf("handle request: %w", fmt.Errorf("query vehicle: %w", rootErr))
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+
+	entry := lastLogLine(t, &buf)
+	require.Equal(t, []any{
+		"handle request: query vehicle: connection refused",
+		"query vehicle: connection refused",
+		"connection refused",
+	}, entry["causes"])
+}
+
+func TestErrorHandlerMatchesRichErrorResponse(t *testing.T) {
+	richErr := richerrors.ErrorWithCodef(fiber.StatusTooManyRequests, "slow down", "rate limit exceeded for %s", "0xabc").
+		WithRetryAfter(1500 * time.Millisecond)
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return richErr
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+	require.NoError(t, err)
+
+	expected := richerrors.ResponseOf(richErr, defaultErrorMessage)
+	require.Equal(t, expected.HTTPStatus, resp.StatusCode)
+	require.Equal(t, strconv.Itoa(expected.RetryAfterSeconds), resp.Header.Get(fiber.HeaderRetryAfter))
+	var body CodedResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, expected.Message, body.Message)
+	require.Equal(t, expected.HTTPStatus, body.Code)
+	require.Equal(t, codes.ResourceExhausted, expected.GRPCCode)
+}
+
+func TestErrorHandlerContentNegotiation(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Get("/", func(c *fiber.Ctx) error {
+		return richerrors.ErrorWithCodef(fiber.StatusNotFound, "vehicle not found", "no vehicle %d", 42)
+	})
+
+	tests := []struct {
+		accept      string
+		contentType string
+		body        string
+	}{
+		{accept: "", contentType: fiber.MIMEApplicationJSON, body: `{"message":"vehicle not found","code":404}`},
+		{accept: "*/*", contentType: fiber.MIMEApplicationJSON, body: `{"message":"vehicle not found","code":404}`},
+		{accept: "application/json", contentType: fiber.MIMEApplicationJSON, body: `{"message":"vehicle not found","code":404}`},
+		{accept: "text/plain", contentType: fiber.MIMETextPlainCharsetUTF8, body: "vehicle not found"},
+		{accept: "application/json;q=0.5, text/plain", contentType: fiber.MIMETextPlainCharsetUTF8, body: "vehicle not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.accept, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.accept != "" {
+				req.Header.Set(fiber.HeaderAccept, tt.accept)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+			require.Equal(t, tt.contentType, resp.Header.Get(fiber.HeaderContentType))
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, tt.body, string(body))
+		})
+	}
+}
+
+func TestContextLoggerSkipPaths(t *testing.T) {
+	var buf bytes.Buffer
+	app := newLoggedApp(&buf, NewContextLoggerMiddleware(ContextLoggerConfig{SkipPaths: []string{"/metrics", "/health"}}))
+	accessLog := func(c *fiber.Ctx) error {
+		zerolog.Ctx(c.UserContext()).Info().Msg("handled")
+		return c.SendStatus(fiber.StatusOK)
+	}
+	app.Get("/health/live", accessLog)
+	app.Get("/healthy", accessLog)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/health/live", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Empty(t, buf.String())
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/healthy", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	entry := lastLogLine(t, &buf)
+	require.Equal(t, "healthy", entry["httpPath"])
+}
+
+func TestRequestIDMiddleware(t *testing.T) {
+	tests := []struct {
+		name      string
+		requestID string
+		generated bool
+	}{
+		{
+			name:      "passthrough",
+			requestID: "abc-123",
+		},
+		{
+			name:      "passthrough max length",
+			requestID: strings.Repeat("a", MaxRequestIDLength),
+		},
+		{
+			name:      "generated",
+			generated: true,
+		},
+		{
+			name:      "too long",
+			requestID: strings.Repeat("a", MaxRequestIDLength+1),
+			generated: true,
+		},
+		{
+			name:      "invalid characters",
+			requestID: `abc" injected="1`,
+			generated: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newLoggedApp(&buf, RequestIDMiddleware)
+			app.Use(ContextLoggerMiddleware)
+			var localID string
+			app.Get("/id", func(c *fiber.Ctx) error {
+				localID = GetRequestID(c)
+				zerolog.Ctx(c.UserContext()).Info().Msg("handled")
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/id", nil)
+			if tt.requestID != "" {
+				req.Header.Set(HeaderRequestID, tt.requestID)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+			requestID := resp.Header.Get(HeaderRequestID)
+			if tt.generated {
+				require.Len(t, requestID, 36)
+			} else {
+				require.Equal(t, tt.requestID, requestID)
+			}
+			require.Equal(t, requestID, localID)
+			entry := lastLogLine(t, &buf)
+			require.Equal(t, requestID, entry["requestId"])
+			require.Equal(t, "id", entry["httpPath"])
+		})
+	}
+}
+
+func TestAccessLogMiddleware(t *testing.T) {
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		level  string
+	}{
+		{
+			name:   "success",
+			path:   "/",
+			status: fiber.StatusOK,
+			level:  "info",
+		},
+		{
+			name:   "server error",
+			path:   "/fail",
+			status: fiber.StatusServiceUnavailable,
+			level:  "error",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newLoggedApp(&buf, AccessLogMiddleware)
+			app.Get("/fail", func(c *fiber.Ctx) error {
+				return fiber.NewError(fiber.StatusServiceUnavailable, "unavailable")
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, tt.path, nil))
+			require.NoError(t, err)
+			require.Equal(t, tt.status, resp.StatusCode)
+
+			entry := lastLogLine(t, &buf)
+			require.Equal(t, "http request completed", entry["message"])
+			require.Equal(t, tt.level, entry["level"])
+			require.Equal(t, float64(tt.status), entry["httpStatusCode"])
+			require.Contains(t, entry, "duration")
+			require.Contains(t, entry, "responseBytes")
+		})
+	}
+}
+
+func TestSendBatchResponse(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/batch", func(c *fiber.Ctx) error {
+		return SendBatchResponse(c, []BatchItemResult{
+			BatchItemSuccess("1", fiber.StatusCreated),
+			BatchItemError("2", richerrors.ErrorWithCodef(fiber.StatusNotFound, "vehicle not found", "no vehicle with id %d", 2)),
+			BatchItemError("3", errors.New("connection refused")),
+		})
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/batch", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusMultiStatus, resp.StatusCode)
+
+	var body BatchResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, BatchResponse{Results: []BatchItemResult{
+		{ID: "1", Status: fiber.StatusCreated},
+		{ID: "2", Status: fiber.StatusNotFound, Error: &CodedResponse{Code: fiber.StatusNotFound, Message: "vehicle not found"}},
+		{ID: "3", Status: fiber.StatusInternalServerError, Error: &CodedResponse{Code: fiber.StatusInternalServerError, Message: defaultErrorMessage}},
+	}}, body)
+}
+
+func TestContextLoggerKeepLeadingSlash(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      ContextLoggerConfig
+		expected string
+	}{
+		{
+			name:     "trimmed by default",
+			expected: "vehicles",
+		},
+		{
+			name:     "keep leading slash",
+			cfg:      ContextLoggerConfig{KeepLeadingSlash: true},
+			expected: "/vehicles",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			app := newLoggedApp(&buf, NewContextLoggerMiddleware(tt.cfg))
+			app.Get("/vehicles", func(c *fiber.Ctx) error {
+				zerolog.Ctx(c.UserContext()).Info().Msg("handled")
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			_, err := app.Test(httptest.NewRequest(http.MethodGet, "/vehicles", nil))
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, lastLogLine(t, &buf)["httpPath"])
+		})
+	}
+}
+
+func TestRecoverMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	app := newLoggedApp(&buf, RecoverMiddleware)
+	app.Get("/panic", func(c *fiber.Ctx) error {
+		panic("nil map write")
+	})
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/panic", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusInternalServerError, resp.StatusCode)
+
+	var body CodedResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, CodedResponse{Code: fiber.StatusInternalServerError, Message: defaultErrorMessage}, body)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &entry))
+	require.Equal(t, "recovered from panic in http handler", entry["message"])
+	require.Equal(t, "nil map write", entry["panic"])
+	require.Contains(t, entry["stack"], "RecoverMiddleware")
+}
+
+func TestErrorHandlerResponseFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{
+			name:     "rich error with error code",
+			err:      richerrors.ErrorWithCodef(fiber.StatusNotFound, "vehicle not found", "no vehicle").WithErrorCode("NOT_FOUND"),
+			expected: `{"code":404,"message":"vehicle not found","errorCode":"NOT_FOUND"}`,
+		},
+		{
+			name:     "rich error without error code",
+			err:      richerrors.ErrorWithCodef(fiber.StatusNotFound, "vehicle not found", "no vehicle"),
+			expected: `{"code":404,"message":"vehicle not found"}`,
+		},
+		{
+			name:     "single validation error",
+			err:      richerrors.ErrorsWithCode(fiber.StatusBadRequest, "invalid vehicle", errors.New("name is required")),
+			expected: `{"code":400,"message":"invalid vehicle","details":["name is required"]}`,
+		},
+		{
+			name: "multiple validation errors",
+			err: richerrors.ErrorsWithCode(fiber.StatusBadRequest, "invalid vehicle",
+				errors.New("name is required"), errors.New("vin must be 17 characters")),
+			expected: `{"code":400,"message":"invalid vehicle","details":["name is required","vin must be 17 characters"]}`,
+		},
+		{
+			name:     "server error details are not exposed",
+			err:      richerrors.ErrorsWithCode(fiber.StatusInternalServerError, "failed to save", errors.New("db timeout"), errors.New("cache down")),
+			expected: `{"code":500,"message":"failed to save"}`,
+		},
+		{
+			name:     "wrapped single error has no details",
+			err:      richerrors.ErrorWithCodef(fiber.StatusBadRequest, "invalid vehicle", "name is required"),
+			expected: `{"code":400,"message":"invalid vehicle"}`,
+		},
+		{
+			name:     "validation fields",
+			err:      richerrors.NewValidationError("invalid vehicle", map[string]string{"vin": "must be 17 characters"}),
+			expected: `{"code":400,"message":"invalid vehicle","errorCode":"BAD_USER_INPUT","validation":{"vin":"must be 17 characters"}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+			app.Get("/", func(c *fiber.Ctx) error {
+				return tt.err
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+			require.NoError(t, err)
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.JSONEq(t, tt.expected, string(body))
+		})
+	}
+}
+
+func TestSetCacheControl(t *testing.T) {
+	tests := []struct {
+		name          string
+		authorization string
+		maxAge        time.Duration
+		opts          []CacheOption
+		cacheControl  string
+		vary          string
+	}{
+		{
+			name:         "public",
+			maxAge:       5 * time.Minute,
+			opts:         []CacheOption{WithVary(fiber.HeaderAcceptEncoding)},
+			cacheControl: "public, max-age=300",
+			vary:         fiber.HeaderAcceptEncoding,
+		},
+		{
+			name:          "authenticated defaults to no-store",
+			authorization: "Bearer token",
+			maxAge:        5 * time.Minute,
+			cacheControl:  "no-store",
+		},
+		{
+			name:          "authenticated private cache",
+			authorization: "Bearer token",
+			maxAge:        time.Minute,
+			opts:          []CacheOption{WithPrivateCache()},
+			cacheControl:  "private, max-age=60",
+			vary:          fiber.HeaderAuthorization,
+		},
+		{
+			name:         "zero max age",
+			cacheControl: "no-store",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				SetCacheControl(c, tt.maxAge, tt.opts...)
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set(fiber.HeaderAuthorization, tt.authorization)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.cacheControl, resp.Header.Get(fiber.HeaderCacheControl))
+			require.Equal(t, tt.vary, resp.Header.Get(fiber.HeaderVary))
+			if tt.cacheControl == "no-store" {
+				require.Equal(t, "0", resp.Header.Get(fiber.HeaderExpires))
+			} else {
+				expires, err := http.ParseTime(resp.Header.Get(fiber.HeaderExpires))
+				require.NoError(t, err)
+				require.WithinDuration(t, time.Now().Add(tt.maxAge), expires, 2*time.Second)
+			}
+		})
+	}
+}
+
+func TestBodyLimitRejection(t *testing.T) {
+	var buf bytes.Buffer
+	reg := prometheus.NewRegistry()
+	app := newLoggedApp(&buf, NewBodyLimitMiddlewareWithConfig(8, BodyLimitConfig{Registerer: reg}))
+	app.Post("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	counter := rejectedRequestsCounter(reg).WithLabelValues(RejectReasonBodyLimit)
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("small")))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Equal(t, 0.0, testutil.ToFloat64(counter))
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodPost, "/", strings.NewReader("too large body")))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusRequestEntityTooLarge, resp.StatusCode)
+	require.Equal(t, 1.0, testutil.ToFloat64(counter))
+
+	var rejection map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]any
+		require.NoError(t, json.Unmarshal(line, &entry))
+		if entry["message"] == "request rejected" {
+			rejection = entry
+		}
+	}
+	require.NotNil(t, rejection)
+	require.Equal(t, "warn", rejection["level"])
+	require.Equal(t, RejectReasonBodyLimit, rejection["rejectReason"])
+}
+
+func TestBodyLimitStreamedBody(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler, StreamRequestBody: true})
+	app.Use(NewBodyLimitMiddleware(8))
+	app.Post("/", func(c *fiber.Ctx) error {
+		return c.Send(c.Body())
+	})
+	// app.Test cannot send a chunked body, so the app serves a real listener
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = app.Listener(lis) }()
+	t.Cleanup(func() { _ = app.Shutdown() })
+
+	// postChunked posts the body with chunked transfer encoding, without a Content-Length header
+	postChunked := func(body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, "http://"+lis.Addr().String()+"/", io.NopCloser(strings.NewReader(body)))
+		require.NoError(t, err)
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { _ = resp.Body.Close() })
+		return resp
+	}
+
+	resp := postChunked("small")
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "small", string(body))
+
+	resp = postChunked("too large body")
+	require.Equal(t, fiber.StatusRequestEntityTooLarge, resp.StatusCode)
+	var coded CodedResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&coded))
+	require.Equal(t, "Request body too large", coded.Message)
+}
+
+func TestNewCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name                string
+		handler             fiber.Handler
+		origin              string
+		expectedAllowOrigin string
+		expectedMaxAge      string
+		expectedCredentials string
+	}{
+		{
+			name:                "allowed origin",
+			handler:             NewCORS([]string{"https://app.dimo.zone"}),
+			origin:              "https://app.dimo.zone",
+			expectedAllowOrigin: "https://app.dimo.zone",
+			expectedMaxAge:      "3600",
+		},
+		{
+			name:    "disallowed origin",
+			handler: NewCORS([]string{"https://app.dimo.zone"}),
+			origin:  "https://evil.example.com",
+		},
+		{
+			name: "overridden config",
+			handler: NewCORSWithConfig([]string{"https://app.dimo.zone"}, CORSConfig{
+				AllowCredentials: true,
+				MaxAge:           10 * time.Minute,
+			}),
+			origin:              "https://app.dimo.zone",
+			expectedAllowOrigin: "https://app.dimo.zone",
+			expectedMaxAge:      "600",
+			expectedCredentials: "true",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(tt.handler)
+			app.Post("/", func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodOptions, "/", nil)
+			req.Header.Set(fiber.HeaderOrigin, tt.origin)
+			req.Header.Set(fiber.HeaderAccessControlRequestMethod, http.MethodPost)
+			req.Header.Set(fiber.HeaderAccessControlRequestHeaders, "Authorization")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusNoContent, resp.StatusCode)
+			require.Equal(t, tt.expectedAllowOrigin, resp.Header.Get(fiber.HeaderAccessControlAllowOrigin))
+			if tt.expectedAllowOrigin == "" {
+				return
+			}
+			require.Contains(t, resp.Header.Get(fiber.HeaderAccessControlAllowHeaders), fiber.HeaderAuthorization)
+			require.Contains(t, resp.Header.Get(fiber.HeaderAccessControlAllowMethods), http.MethodPost)
+			require.Equal(t, tt.expectedMaxAge, resp.Header.Get(fiber.HeaderAccessControlMaxAge))
+			require.Equal(t, tt.expectedCredentials, resp.Header.Get(fiber.HeaderAccessControlAllowCredentials))
+		})
+	}
+}
+
+func TestRateLimitByIP(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	// The test requests come from 0.0.0.0, trust it as a proxy to set the source IP.
+	app.Use(RateLimitByIP(2, time.Minute, NewMemoryLimiterStore(), netip.MustParsePrefix("0.0.0.0/32")))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	doRequest := func(ip string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, ip)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	require.Equal(t, fiber.StatusOK, doRequest("203.0.113.7").StatusCode)
+	require.Equal(t, fiber.StatusOK, doRequest("203.0.113.7").StatusCode)
+	resp := doRequest("203.0.113.7")
+	require.Equal(t, fiber.StatusTooManyRequests, resp.StatusCode)
+	retryAfter, err := strconv.Atoi(resp.Header.Get(fiber.HeaderRetryAfter))
+	require.NoError(t, err)
+	require.Positive(t, retryAfter)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"code":429,"message":"Too many requests","errorCode":"TOO_MANY_REQUESTS"}`, string(body))
+
+	// Other source IPs have their own limit.
+	require.Equal(t, fiber.StatusOK, doRequest("203.0.113.8").StatusCode)
+}
+
+func TestRateLimitByIPIgnoresSpoofedHeaders(t *testing.T) {
+	for _, trustedProxies := range [][]netip.Prefix{nil, {netip.MustParsePrefix("10.0.0.0/8")}} {
+		app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+		app.Use(RateLimitByIP(2, time.Minute, NewMemoryLimiterStore(), trustedProxies...))
+		app.Get("/", func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		})
+		doRequest := func(header, ip string) int {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set(header, ip)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			return resp.StatusCode
+		}
+
+		// A client that is not a trusted proxy is limited by its own address whatever it forwards.
+		require.Equal(t, fiber.StatusOK, doRequest(fiber.HeaderXForwardedFor, "203.0.113.1"))
+		require.Equal(t, fiber.StatusOK, doRequest("X-Real-IP", "203.0.113.2"))
+		require.Equal(t, fiber.StatusTooManyRequests, doRequest(fiber.HeaderXForwardedFor, "203.0.113.3"))
+	}
+}
+
+func TestRateLimitByIPIgnoresSpoofedForwardedEntries(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	// The test requests come from 0.0.0.0, which is a trusted proxy like the load balancer in 10.0.0.0/8.
+	app.Use(RateLimitByIP(2, time.Minute, NewMemoryLimiterStore(),
+		netip.MustParsePrefix("0.0.0.0/32"), netip.MustParsePrefix("10.0.0.0/8")))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	doRequest := func(forwardedFor string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(fiber.HeaderXForwardedFor, forwardedFor)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	// The client rotates a spoofed leading entry, the proxies append its real address and their own.
+	require.Equal(t, fiber.StatusOK, doRequest("198.51.100.1, 203.0.113.7, 10.0.0.2"))
+	require.Equal(t, fiber.StatusOK, doRequest("198.51.100.2, 203.0.113.7, 10.0.0.2"))
+	require.Equal(t, fiber.StatusTooManyRequests, doRequest("198.51.100.3, 203.0.113.7"))
+	// The spoofed address has no limit of its own.
+	require.Equal(t, fiber.StatusTooManyRequests, doRequest("203.0.113.8, 203.0.113.7"))
+	require.Equal(t, fiber.StatusOK, doRequest("203.0.113.8"))
+}
+
+func TestMemoryLimiterStoreRefill(t *testing.T) {
+	now := time.Now()
+	store := NewMemoryLimiterStore()
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	allowed, _, err := store.Take(ctx, "key", 1, time.Second)
+	require.NoError(t, err)
+	require.True(t, allowed)
+	allowed, retryAfter, err := store.Take(ctx, "key", 1, time.Second)
+	require.NoError(t, err)
+	require.False(t, allowed)
+	require.Equal(t, time.Second, retryAfter)
+
+	now = now.Add(time.Second)
+	allowed, _, err = store.Take(ctx, "key", 1, time.Second)
+	require.NoError(t, err)
+	require.True(t, allowed)
+}
+
+func TestRateLimitMiddlewareByCaller(t *testing.T) {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		if subject := c.Get("X-Test-Subject"); subject != "" {
+			claims := &tokenclaims.Token{}
+			claims.Subject = subject
+			c.Locals(jwtmiddleware.TokenClaimsKey, &jwt.Token{Claims: claims})
+		}
+		return c.Next()
+	})
+	app.Use(RateLimitMiddleware(1, time.Minute))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	doRequest := func(subject string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("X-Test-Subject", subject)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	const caller = "0x1234567890123456789012345678901234567890"
+	const other = "0x0000000000000000000000000000000000000001"
+	require.Equal(t, fiber.StatusOK, doRequest(caller))
+	require.Equal(t, fiber.StatusTooManyRequests, doRequest(caller))
+	// Other callers, authenticated or anonymous, have their own limit.
+	require.Equal(t, fiber.StatusOK, doRequest(other))
+	require.Equal(t, fiber.StatusOK, doRequest(""))
+	require.Equal(t, fiber.StatusTooManyRequests, doRequest(""))
+}
+
+func TestReadinessHandler(t *testing.T) {
+	checker := health.NewChecker(0)
+	app := fiber.New()
+	app.Get("/ready", NewReadinessHandler(checker))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	checker.Add("db", func(context.Context) error { return errors.New("connection refused") })
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+	var result health.Result
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.False(t, result.Healthy)
+	require.Equal(t, []string{"db"}, result.Failed())
+	// The error details are only returned when enabled.
+	require.Empty(t, result.Checks[0].Error)
+
+	app = fiber.New()
+	app.Get("/ready", NewReadinessHandler(checker, WithReadinessErrorDetails()))
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/ready", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	require.Equal(t, "connection refused", result.Checks[0].Error)
+}
+
+func TestMountMonitoring(t *testing.T) {
+	app := fiber.New()
+	MountMonitoring(app, true, monserver.WithReadinessCheck("db", func(context.Context) error { return nil }))
+	app.Get("/api", func(c *fiber.Ctx) error { return c.SendString("api") })
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Contains(t, string(body), "# TYPE go_goroutines gauge")
+
+	for path, want := range map[string]string{"/health": "healthy", "/livez": "healthy", "/ready": "ready", "/readyz": "ready", "/api": "api"} {
+		resp, err = app.Test(httptest.NewRequest(http.MethodGet, path, nil))
+		require.NoError(t, err)
+		require.Equal(t, fiber.StatusOK, resp.StatusCode, path)
+		body, err = io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Equal(t, want, string(body), path)
+	}
+
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	app = fiber.New()
+	MountMonitoring(app, false)
+	resp, err = app.Test(httptest.NewRequest(http.MethodGet, "/debug/pprof/", nil))
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusNotFound, resp.StatusCode)
+}
@@ -0,0 +1,52 @@
+package fibercommon
+
+import (
+	"github.com/DIMO-Network/server-garage/pkg/health"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+// ReadinessOption configures the handler created by NewReadinessHandler.
+type ReadinessOption func(*readinessConfig)
+
+type readinessConfig struct {
+	errorDetails bool
+}
+
+// WithReadinessErrorDetails returns a ReadinessOption that includes the error messages of the failed checks
+// in the response. Only use it when the route is not exposed publicly, since the messages may contain internal details.
+func WithReadinessErrorDetails() ReadinessOption {
+	return func(c *readinessConfig) {
+		c.errorDetails = true
+	}
+}
+
+// NewReadinessHandler creates a handler that runs the checks of the checker and responds with the health.Result as JSON,
+// with a 503 status when a check is unhealthy. Register it as the readiness route of the app, e.g. app.Get("/ready", ...),
+// and share the checker with the monitoring server, see monserver.WithHealthChecker.
+// The result only contains the names and status of the checks, the errors of the failed checks are logged at debug
+// level and only returned with WithReadinessErrorDetails.
+func NewReadinessHandler(checker *health.Checker, opts ...ReadinessOption) fiber.Handler {
+	cfg := &readinessConfig{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return func(c *fiber.Ctx) error {
+		result := checker.Run(c.UserContext())
+		if !result.Healthy {
+			logger := zerolog.Ctx(c.UserContext())
+			for _, check := range result.Checks {
+				if !check.Healthy {
+					logger.Debug().Err(check.Err()).Str("check", check.Name).Msg("readiness check failed")
+				}
+			}
+		}
+		if !cfg.errorDetails {
+			result = result.WithoutErrors()
+		}
+		if !result.Healthy {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(result)
+		}
+		return c.JSON(result)
+	}
+}
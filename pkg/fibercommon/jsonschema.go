@@ -0,0 +1,92 @@
+package fibercommon
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/jsonschema-go/jsonschema"
+)
+
+// JSONSchemaMiddleware creates a middleware that validates the request body against the given JSON schema
+// before the next handler runs. Invalid bodies are rejected with a 400 richerrors.Error created by
+// richerrors.NewValidationError, whose fields hold the failures keyed by the JSON pointer of the invalid value,
+// e.g. /year. Each property of an object schema is validated on its own, so all invalid properties are reported;
+// other failures, such as a body of the wrong type, are reported at the root pointer "".
+// The middleware is meant to be added to individual routes.
+func JSONSchemaMiddleware(schema *jsonschema.Schema) (fiber.Handler, error) {
+	resolved, err := schema.Resolve(nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve JSON schema: %w", err)
+	}
+	properties := make(map[string]*jsonschema.Resolved, len(schema.Properties))
+	for name, property := range schema.Properties {
+		// properties referencing other parts of the schema cannot be resolved on their own,
+		// their failures are reported at the root pointer
+		if resolvedProperty, err := property.Resolve(nil); err == nil {
+			properties[name] = resolvedProperty
+		}
+	}
+	return func(c *fiber.Ctx) error {
+		var body any
+		if err := json.Unmarshal(c.Body(), &body); err != nil {
+			return richerrors.Error{
+				Code:        fiber.StatusBadRequest,
+				ExternalMsg: "invalid JSON body",
+				Err:         err,
+			}
+		}
+		if err := resolved.Validate(body); err != nil {
+			validationErr := richerrors.NewValidationError("request body does not match schema", schemaFailures(schema, properties, body, err))
+			validationErr.Err = err
+			return validationErr
+		}
+		return c.Next()
+	}, nil
+}
+
+// schemaFailures returns the failure messages of an invalid body keyed by the JSON pointer of the invalid value.
+// If no property of an object body is missing or invalid, the validation error is reported at the root pointer.
+func schemaFailures(schema *jsonschema.Schema, properties map[string]*jsonschema.Resolved, body any, err error) map[string]string {
+	failures := make(map[string]string)
+	if object, ok := body.(map[string]any); ok {
+		for _, name := range schema.Required {
+			if _, ok := object[name]; !ok {
+				failures[jsonPointer(name)] = "missing required property"
+			}
+		}
+		for name, property := range properties {
+			value, ok := object[name]
+			if !ok {
+				continue
+			}
+			if err := property.Validate(value); err != nil {
+				failures[jsonPointer(name)] = validationCause(err)
+			}
+		}
+	}
+	if len(failures) == 0 {
+		failures[""] = validationCause(err)
+	}
+	return failures
+}
+
+// validationCause returns the message of the innermost error of a validation error, which describes the failed
+// keyword without the schema locations wrapping it.
+func validationCause(err error) string {
+	for {
+		cause := errors.Unwrap(err)
+		if cause == nil {
+			return err.Error()
+		}
+		err = cause
+	}
+}
+
+// jsonPointer returns the JSON pointer of a top level property, see RFC 6901.
+func jsonPointer(property string) string {
+	return "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(property)
+}
@@ -0,0 +1,99 @@
+package fibercommon
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/jsonschema-go/jsonschema"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJSONSchemaMiddleware(t *testing.T) {
+	schema := &jsonschema.Schema{
+		Type:     "object",
+		Required: []string{"name"},
+		Properties: map[string]*jsonschema.Schema{
+			"name": {Type: "string"},
+			"year": {Type: "integer"},
+		},
+	}
+	validate, err := JSONSchemaMiddleware(schema)
+	require.NoError(t, err)
+
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Post("/vehicles", validate, func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	tests := []struct {
+		name           string
+		body           string
+		expectedCode   int
+		expectedMsg    string
+		expectedFields []string
+	}{
+		{
+			name:         "valid payload",
+			body:         `{"name":"car","year":2024}`,
+			expectedCode: fiber.StatusCreated,
+		},
+		{
+			name:           "missing required field",
+			body:           `{"year":2024}`,
+			expectedCode:   fiber.StatusBadRequest,
+			expectedMsg:    "request body does not match schema",
+			expectedFields: []string{"/name"},
+		},
+		{
+			name:           "wrong field type",
+			body:           `{"name":"car","year":"new"}`,
+			expectedCode:   fiber.StatusBadRequest,
+			expectedMsg:    "request body does not match schema",
+			expectedFields: []string{"/year"},
+		},
+		{
+			name:           "multiple invalid fields",
+			body:           `{"name":1,"year":"new"}`,
+			expectedCode:   fiber.StatusBadRequest,
+			expectedMsg:    "request body does not match schema",
+			expectedFields: []string{"/name", "/year"},
+		},
+		{
+			name:           "wrong body type",
+			body:           `["car"]`,
+			expectedCode:   fiber.StatusBadRequest,
+			expectedMsg:    "request body does not match schema",
+			expectedFields: []string{""},
+		},
+		{
+			name:         "malformed JSON",
+			body:         `{"name":`,
+			expectedCode: fiber.StatusBadRequest,
+			expectedMsg:  "invalid JSON body",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/vehicles", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+			if tt.expectedMsg == "" {
+				return
+			}
+			var body CodedResponse
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+			require.Equal(t, tt.expectedMsg, body.Message)
+			require.Len(t, body.Fields, len(tt.expectedFields))
+			for _, field := range tt.expectedFields {
+				require.NotEmpty(t, body.Fields[field], "missing failure of %q", field)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package jwtmiddleware
+
+import (
+	"errors"
+	"fmt"
+
+	jwtware "github.com/gofiber/contrib/jwt"
+	"github.com/gofiber/fiber/v2"
+)
+
+// DefaultRealm is the realm of the WWW-Authenticate challenge when none is configured.
+const DefaultRealm = "dimo"
+
+// Bearer token error codes defined by RFC 6750 section 3.1.
+const (
+	// ErrorCodeInvalidRequest is used when the request is missing a parameter or is otherwise malformed.
+	ErrorCodeInvalidRequest = "invalid_request"
+	// ErrorCodeInvalidToken is used when the token is expired, revoked, malformed or otherwise invalid.
+	ErrorCodeInvalidToken = "invalid_token"
+	// ErrorCodeInsufficientScope is used when the token does not grant the privileges required by the request.
+	ErrorCodeInsufficientScope = "insufficient_scope"
+)
+
+// SetBearerChallenge sets the WWW-Authenticate header to a Bearer challenge for the realm as described in RFC 6750.
+// The error attribute is omitted when errorCode is empty, which is the expected response to a request without credentials.
+func SetBearerChallenge(c *fiber.Ctx, realm, errorCode string) {
+	if realm == "" {
+		realm = DefaultRealm
+	}
+	challenge := fmt.Sprintf("Bearer realm=%q", realm)
+	if errorCode != "" {
+		challenge += fmt.Sprintf(", error=%q", errorCode)
+	}
+	c.Set(fiber.HeaderWWWAuthenticate, challenge)
+}
+
+// authErrorHandler returns a jwtware error handler that responds with a Bearer challenge.
+// Requests without an Authorization header get a 401 without an error code, malformed headers a 400
+// with invalid_request and all other failures a 401 with invalid_token.
+func authErrorHandler(realm string) fiber.ErrorHandler {
+	return func(c *fiber.Ctx, err error) error {
+		if errors.Is(err, jwtware.ErrJWTMissingOrMalformed) {
+			if c.Get(fiber.HeaderAuthorization) == "" {
+				SetBearerChallenge(c, realm, "")
+				return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! missing token")
+			}
+			SetBearerChallenge(c, realm, ErrorCodeInvalidRequest)
+			return fiber.NewError(fiber.StatusBadRequest, "Missing or malformed JWT")
+		}
+		SetBearerChallenge(c, realm, ErrorCodeInvalidToken)
+		return fiber.NewError(fiber.StatusUnauthorized, "Invalid or expired JWT")
+	}
+}
@@ -0,0 +1,123 @@
+package jwtmiddleware
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
+	jwtware "github.com/gofiber/contrib/jwt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// errAlgorithmNotAllowed is returned for tokens signed with an algorithm that is not in Config.AllowedAlgorithms.
+var errAlgorithmNotAllowed = errors.New("token signing algorithm is not allowed")
+
+// Config configures the middleware created by NewJWTMiddlewareWithConfig.
+type Config struct {
+	// JWKSetURLs are the URLs of the JWK Sets used to validate tokens. Ignored if KeySet is set.
+	JWKSetURLs []string
+	// KeySet is used to validate tokens instead of fetching the JWKSetURLs at creation.
+	KeySet *KeySet
+	// Audiences are the accepted audiences. When set, the token must contain at least one of them.
+	Audiences []string
+	// ExactAudience, when set, requires the token to contain exactly one audience equal to this value.
+	// This is stricter than Audiences and meant for single-audience tokens.
+	ExactAudience string
+	// AllowedAlgorithms are the accepted signing algorithms, e.g. RS256 and ES256. Tokens signed with any other
+	// algorithm are rejected before the signature is verified, which protects against algorithm confusion.
+	// If empty, every algorithm matching the key is accepted.
+	AllowedAlgorithms []string
+	// Issuers are the accepted issuers. When set, the token issuer must be one of them.
+	Issuers []string
+	// Optional lets requests without an Authorization header through without claims.
+	// Requests with a token are still rejected if the token is invalid.
+	Optional bool
+	// Realm is the realm of the WWW-Authenticate challenge sent with authentication failures.
+	// If empty, DefaultRealm is used.
+	Realm string
+}
+
+// NewJWTMiddlewareWithConfig creates a new JWT token middleware with the given configuration
+// that validates the token and stores the claims in the fiber context.
+func NewJWTMiddlewareWithConfig(cfg Config) fiber.Handler {
+	jwtCfg := jwtware.Config{
+		JWKSetURLs:   cfg.JWKSetURLs,
+		Claims:       &tokenclaims.Token{},
+		ContextKey:   TokenClaimsKey,
+		ErrorHandler: authErrorHandler(cfg.Realm),
+		SuccessHandler: func(c *fiber.Ctx) error {
+			if err := validateClaims(c, cfg); err != nil {
+				return err
+			}
+			return c.Next()
+		},
+	}
+	if cfg.Optional {
+		jwtCfg.Filter = func(c *fiber.Ctx) bool {
+			return c.Get(fiber.HeaderAuthorization) == ""
+		}
+	}
+	if len(cfg.AllowedAlgorithms) != 0 {
+		jwtCfg.TokenProcessorFunc = allowedAlgorithms(cfg.AllowedAlgorithms)
+	}
+	if cfg.KeySet != nil {
+		jwtCfg.JWKSetURLs = nil
+		jwtCfg.KeyFunc = cfg.KeySet.jwks.Keyfunc
+	}
+	return jwtware.New(jwtCfg)
+}
+
+// allowedAlgorithms returns a token processor that rejects tokens whose header alg is not one of algorithms.
+func allowedAlgorithms(algorithms []string) func(string) (string, error) {
+	return func(token string) (string, error) {
+		parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+		if err != nil {
+			return "", fmt.Errorf("failed to parse token header: %w", err)
+		}
+		if alg := parsed.Method.Alg(); !slices.Contains(algorithms, alg) {
+			return "", fmt.Errorf("%w: %s", errAlgorithmNotAllowed, alg)
+		}
+		return token, nil
+	}
+}
+
+// NewJWTMiddlewareWithValidation is like NewJWTMiddlewareWithConfig but requires the configuration to assert
+// the audience or the issuer of the token, so a token signed by a trusted key for another service is rejected.
+// The claims are checked after the signature is verified and mismatches return 401.
+// It panics if none of Audiences, ExactAudience and Issuers is set.
+func NewJWTMiddlewareWithValidation(cfg Config) fiber.Handler {
+	if cfg.ExactAudience == "" && len(cfg.Audiences) == 0 && len(cfg.Issuers) == 0 {
+		panic("jwtmiddleware: NewJWTMiddlewareWithValidation requires at least one of Audiences, ExactAudience or Issuers")
+	}
+	return NewJWTMiddlewareWithConfig(cfg)
+}
+
+// validateClaims validates the registered claims of the token against the configuration.
+func validateClaims(c *fiber.Ctx, cfg Config) error {
+	if cfg.ExactAudience == "" && len(cfg.Audiences) == 0 && len(cfg.Issuers) == 0 {
+		return nil
+	}
+	claims, err := GetTokenClaim(c)
+	if err != nil {
+		return err
+	}
+	if cfg.ExactAudience != "" {
+		if len(claims.Audience) != 1 || claims.Audience[0] != cfg.ExactAudience {
+			SetBearerChallenge(c, cfg.Realm, ErrorCodeInvalidToken)
+			return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! invalid token audience")
+		}
+	}
+	if len(cfg.Audiences) != 0 && !slices.ContainsFunc(claims.Audience, func(aud string) bool {
+		return slices.Contains(cfg.Audiences, aud)
+	}) {
+		SetBearerChallenge(c, cfg.Realm, ErrorCodeInvalidToken)
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! invalid token audience")
+	}
+	if len(cfg.Issuers) != 0 && !slices.Contains(cfg.Issuers, claims.Issuer) {
+		SetBearerChallenge(c, cfg.Realm, ErrorCodeInvalidToken)
+		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! invalid token issuer")
+	}
+	return nil
+}
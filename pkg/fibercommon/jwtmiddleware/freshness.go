@@ -0,0 +1,30 @@
+package jwtmiddleware
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RequireFreshToken creates a middleware that rejects tokens issued more than maxAge ago with 401, even if they are
+// not expired, to force a re-authentication before sensitive operations. Tokens without an issued at claim are rejected.
+// It must run after the JWT middleware that stores the claims.
+// The options configure the challenge realm and the audit log as for the permission middlewares.
+func RequireFreshToken(maxAge time.Duration, opts ...PermissionOption) fiber.Handler {
+	cfg := newPermissionConfig(opts)
+	return func(c *fiber.Ctx) error {
+		claims, err := GetTokenClaim(c)
+		if err != nil {
+			SetBearerChallenge(c, cfg.realm, ErrorCodeInvalidToken)
+			return err
+		}
+		if claims.IssuedAt == nil || time.Since(claims.IssuedAt.Time) > maxAge {
+			SetBearerChallenge(c, cfg.realm, ErrorCodeInvalidToken)
+			return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! token is too old, please re-authenticate")
+		}
+		if cfg.auditLog {
+			auditLog(c, claims).Time("issuedAt", claims.IssuedAt.Time).Msg("fresh token accepted")
+		}
+		return c.Next()
+	}
+}
@@ -1,16 +1,18 @@
 package jwtmiddleware
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"slices"
 
 	"github.com/DIMO-Network/cloudevent"
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
 	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
 	"github.com/ethereum/go-ethereum/common"
-	jwtware "github.com/gofiber/contrib/jwt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
 )
 
 const (
@@ -18,123 +20,370 @@ const (
 	TokenClaimsKey = "user"
 )
 
+// ErrTokenNotFound is returned by GetTokenClaim when the request has no validated token,
+// e.g. an anonymous request through NewOptionalJWTMiddleware. It responds with 401.
+var ErrTokenNotFound = fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! Internal server error while getting token")
+
 // NewJWTMiddleware creates a new JWT token middleware that validates the token and stores the claims in the fiber context.
 func NewJWTMiddleware(jwkSetURLs ...string) fiber.Handler {
-	return jwtware.New(jwtware.Config{
-		JWKSetURLs: jwkSetURLs,
-		Claims:     &tokenclaims.Token{},
-		ContextKey: TokenClaimsKey,
-	})
+	return NewJWTMiddlewareWithConfig(Config{JWKSetURLs: jwkSetURLs})
+}
+
+// NewOptionalJWTMiddleware creates a new JWT token middleware for endpoints that serve both anonymous and authenticated users.
+// Requests without an Authorization header pass without claims, in which case GetTokenClaim returns ErrTokenNotFound.
+// A present token is validated and its claims are stored in the fiber context, while an invalid token is rejected.
+func NewOptionalJWTMiddleware(jwkSetURLs ...string) fiber.Handler {
+	return NewJWTMiddlewareWithConfig(Config{JWKSetURLs: jwkSetURLs, Optional: true})
+}
+
+// PermissionOption configures the permission middlewares.
+type PermissionOption func(*permissionConfig)
+
+// permissionConfig holds internal configuration for the permission middlewares.
+type permissionConfig struct {
+	auditLog     bool
+	realm        string
+	strictStatus bool
+}
+
+// WithAuditLog returns a PermissionOption that logs an audit event with the context logger for every granted request.
+// The event includes the matched permission for one-of checks and the required permissions for all-of checks.
+func WithAuditLog() PermissionOption {
+	return func(c *permissionConfig) { c.auditLog = true }
+}
+
+// WithRealm returns a PermissionOption that sets the realm of the WWW-Authenticate challenge sent with permission failures.
+// If not set, DefaultRealm is used.
+func WithRealm(realm string) PermissionOption {
+	return func(c *permissionConfig) { c.realm = realm }
+}
+
+// WithStrictStatusCodes returns a PermissionOption that responds 403 to a valid token that does not grant the request
+// and 400 to a malformed path parameter, as recommended by RFC 6750. By default both respond 401.
+func WithStrictStatusCodes() PermissionOption {
+	return func(c *permissionConfig) { c.strictStatus = true }
+}
+
+// deniedStatus returns the status of a failed permission check.
+func (cfg permissionConfig) deniedStatus() int {
+	if cfg.strictStatus {
+		return fiber.StatusForbidden
+	}
+	return fiber.StatusUnauthorized
+}
+
+func newPermissionConfig(opts []PermissionOption) permissionConfig {
+	var cfg permissionConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
 }
 
 // AllOfPermissions creates a middleware that checks if the token contains all the required.
 // This middleware also checks if the token is for the correct contract and token ID.
-func AllOfPermissions(contract common.Address, tokenIDParam string, permissions []string) fiber.Handler {
+func AllOfPermissions(contract common.Address, tokenIDParam string, permissions []string, opts ...PermissionOption) fiber.Handler {
+	cfg := newPermissionConfig(opts)
 	return func(c *fiber.Ctx) error {
-		tokenID, err := getTokenID(c, tokenIDParam)
+		tokenID, err := getTokenID(c, tokenIDParam, cfg)
 		if err != nil {
+			SetBearerChallenge(c, cfg.realm, challengeErrorCode(err))
 			return err
 		}
-		return checkAllPrivileges(c, contract, tokenID, permissions)
+		return checkAllPrivileges(c, []common.Address{contract}, tokenID, permissions, cfg)
 	}
 }
 
 // OneOfPermissions creates a middleware that checks if the token contains any of the required.
 // This middleware also checks if the token is for the correct contract and token ID.
-func OneOfPermissions(contract common.Address, tokenIDParam string, permissions []string) fiber.Handler {
+func OneOfPermissions(contract common.Address, tokenIDParam string, permissions []string, opts ...PermissionOption) fiber.Handler {
+	cfg := newPermissionConfig(opts)
+	return func(c *fiber.Ctx) error {
+		tokenID, err := getTokenID(c, tokenIDParam, cfg)
+		if err != nil {
+			SetBearerChallenge(c, cfg.realm, challengeErrorCode(err))
+			return err
+		}
+		return checkOneOfPrivileges(c, []common.Address{contract}, tokenID, permissions, cfg)
+	}
+}
+
+// AllOfPermissionsMultiContract creates a middleware that checks if the token contains all the required permissions.
+// This middleware also checks if the token is for the token ID of any of the given contracts,
+// e.g. for endpoints shared by vehicle and aftermarket device NFTs.
+func AllOfPermissionsMultiContract(contracts []common.Address, tokenIDParam string, permissions []string, opts ...PermissionOption) fiber.Handler {
+	cfg := newPermissionConfig(opts)
 	return func(c *fiber.Ctx) error {
-		tokenID, err := getTokenID(c, tokenIDParam)
+		tokenID, err := getTokenID(c, tokenIDParam, cfg)
 		if err != nil {
+			SetBearerChallenge(c, cfg.realm, challengeErrorCode(err))
 			return err
 		}
-		return checkOneOfPrivileges(c, contract, tokenID, permissions)
+		return checkAllPrivileges(c, contracts, tokenID, permissions, cfg)
+	}
+}
+
+// OneOfPermissionsMultiContract creates a middleware that checks if the token contains any of the required permissions.
+// This middleware also checks if the token is for the token ID of any of the given contracts.
+func OneOfPermissionsMultiContract(contracts []common.Address, tokenIDParam string, permissions []string, opts ...PermissionOption) fiber.Handler {
+	cfg := newPermissionConfig(opts)
+	return func(c *fiber.Ctx) error {
+		tokenID, err := getTokenID(c, tokenIDParam, cfg)
+		if err != nil {
+			SetBearerChallenge(c, cfg.realm, challengeErrorCode(err))
+			return err
+		}
+		return checkOneOfPrivileges(c, contracts, tokenID, permissions, cfg)
 	}
 }
 
 // AllOfPermissionsAddress creates a middleware that checks if the token contains all the required.
 // This middleware also checks if the token is for the correct contract and token ID.
-func AllOfPermissionsAddress(addressParam string, permissions []string) fiber.Handler {
+func AllOfPermissionsAddress(addressParam string, permissions []string, opts ...PermissionOption) fiber.Handler {
+	cfg := newPermissionConfig(opts)
 	return func(c *fiber.Ctx) error {
-		ethAddress, err := getEthAddress(c, addressParam)
+		ethAddress, err := getEthAddress(c, addressParam, cfg)
 		if err != nil {
+			SetBearerChallenge(c, cfg.realm, challengeErrorCode(err))
 			return err
 		}
-		return checkAllPrivileges(c, ethAddress, nil, permissions)
+		return checkAllPrivileges(c, []common.Address{ethAddress}, nil, permissions, cfg)
 	}
 }
 
 // OneOfPermissionsAddress creates a middleware that checks if the token contains any of the required.
 // This middleware also checks if the token is for the correct contract and token ID.
-func OneOfPermissionsAddress(addressParam string, permissions []string) fiber.Handler {
+func OneOfPermissionsAddress(addressParam string, permissions []string, opts ...PermissionOption) fiber.Handler {
+	cfg := newPermissionConfig(opts)
 	return func(c *fiber.Ctx) error {
-		ethAddress, err := getEthAddress(c, addressParam)
+		ethAddress, err := getEthAddress(c, addressParam, cfg)
 		if err != nil {
+			SetBearerChallenge(c, cfg.realm, challengeErrorCode(err))
 			return err
 		}
-		return checkOneOfPrivileges(c, ethAddress, nil, permissions)
+		return checkOneOfPrivileges(c, []common.Address{ethAddress}, nil, permissions, cfg)
+	}
+}
+
+// CheckAllPermissions checks that the claims are for the token ID of the contract and contain all the permissions,
+// without a fiber context, e.g. in a resolver or service that already holds the claims. If tokenID is nil only the
+// contract is checked.
+// It returns a 401 richerrors.Error if the check fails, or a 403 one with WithStrictStatusCodes.
+func CheckAllPermissions(claims *tokenclaims.Token, contract common.Address, tokenID *big.Int, permissions []string, opts ...PermissionOption) error {
+	cfg := newPermissionConfig(opts)
+	if denial := assetDenial(claims, []common.Address{contract}, tokenID); denial != nil {
+		return denial.richError(cfg)
+	}
+	if denial := allOfDenial(claims.Permissions, permissions); denial != nil {
+		return denial.richError(cfg)
 	}
+	return nil
 }
 
-func checkOneOfPrivileges(ctx *fiber.Ctx, contract common.Address, tokenID *big.Int, permissions []string) error {
+// CheckOneOfPermissions is like CheckAllPermissions but checks that the claims contain any of the permissions.
+func CheckOneOfPermissions(claims *tokenclaims.Token, contract common.Address, tokenID *big.Int, permissions []string, opts ...PermissionOption) error {
+	cfg := newPermissionConfig(opts)
+	if denial := assetDenial(claims, []common.Address{contract}, tokenID); denial != nil {
+		return denial.richError(cfg)
+	}
+	if _, denial := oneOfDenial(claims.Permissions, permissions); denial != nil {
+		return denial.richError(cfg)
+	}
+	return nil
+}
+
+func checkOneOfPrivileges(ctx *fiber.Ctx, contracts []common.Address, tokenID *big.Int, permissions []string, cfg permissionConfig) error {
 	claims, err := GetTokenClaim(ctx)
 	if err != nil {
+		SetBearerChallenge(ctx, cfg.realm, ErrorCodeInvalidToken)
 		return err
 	}
 	// This checks that the privileges are for the token specified by the path variable and the contract address is correct.
-	err = validateTokenIDAndAddress(ctx, contract, tokenID, claims)
+	err = validateTokenIDAndAddress(ctx, contracts, tokenID, claims, cfg)
 	if err != nil {
+		SetBearerChallenge(ctx, cfg.realm, ErrorCodeInsufficientScope)
 		return err
 	}
 
-	for _, v := range permissions {
-		if slices.Contains(claims.Permissions, v) {
-			return ctx.Next()
-		}
+	matched, denial := oneOfDenial(claims.Permissions, permissions)
+	if denial != nil {
+		SetBearerChallenge(ctx, cfg.realm, ErrorCodeInsufficientScope)
+		return denial.fiberError(ctx, claims, cfg)
 	}
-
-	return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! Token does not contain any of the required privileges")
+	if cfg.auditLog {
+		auditLog(ctx, claims).Str("matchedPermission", matched).Msg("permission granted")
+	}
+	return ctx.Next()
 }
 
-func checkAllPrivileges(ctx *fiber.Ctx, contract common.Address, tokenID *big.Int, permissions []string) error {
+func checkAllPrivileges(ctx *fiber.Ctx, contracts []common.Address, tokenID *big.Int, permissions []string, cfg permissionConfig) error {
 	claims, err := GetTokenClaim(ctx)
 	if err != nil {
+		SetBearerChallenge(ctx, cfg.realm, ErrorCodeInvalidToken)
 		return err
 	}
 	// This checks that the privileges are for the token specified by the path variable and the contract address is correct.
-	err = validateTokenIDAndAddress(ctx, contract, tokenID, claims)
+	err = validateTokenIDAndAddress(ctx, contracts, tokenID, claims, cfg)
 	if err != nil {
+		SetBearerChallenge(ctx, cfg.realm, ErrorCodeInsufficientScope)
 		return err
 	}
 
-	for _, v := range permissions {
-		if !slices.Contains(claims.Permissions, v) {
-			return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! Token does not contain required privileges")
-		}
+	if denial := allOfDenial(claims.Permissions, permissions); denial != nil {
+		SetBearerChallenge(ctx, cfg.realm, ErrorCodeInsufficientScope)
+		return denial.fiberError(ctx, claims, cfg)
 	}
 
+	if cfg.auditLog {
+		auditLog(ctx, claims).Strs("requiredPermissions", permissions).Msg("permission granted")
+	}
 	return ctx.Next()
 }
 
-func validateTokenIDAndAddress(ctx *fiber.Ctx, contract common.Address, tokenID *big.Int, claims *tokenclaims.Token) error {
+// auditLog starts an audit log event for the request with the token subject and asset.
+func auditLog(ctx *fiber.Ctx, claims *tokenclaims.Token) *zerolog.Event {
+	return zerolog.Ctx(ctx.UserContext()).Info().
+		Bool("audit", true).
+		Str("subject", claims.Subject).
+		Str("asset", claims.Asset).
+		Str("httpPath", ctx.Path())
+}
+
+// Reasons logged as denyReason when a permission check fails. They are only logged, the client gets a generic message.
+const (
+	denyReasonInvalidAsset       = "invalid_asset"
+	denyReasonTokenIDMismatch    = "token_id_mismatch"
+	denyReasonContractMismatch   = "contract_mismatch"
+	denyReasonMissingPermissions = "missing_permissions"
+)
+
+// permissionDenial is a failed permission check.
+type permissionDenial struct {
+	reason string
+	// message is returned to the client.
+	message string
+	// details adds the details of the reason to the denial log.
+	details func(*zerolog.Event) *zerolog.Event
+}
+
+// richError returns the error returned by the permission check functions.
+func (d *permissionDenial) richError(cfg permissionConfig) error {
+	errorCode := "UNAUTHORIZED"
+	if cfg.strictStatus {
+		errorCode = "FORBIDDEN"
+	}
+	return richerrors.Error{
+		Code:        cfg.deniedStatus(),
+		ExternalMsg: d.message,
+		Err:         errors.New(d.reason),
+		ErrorCode:   errorCode,
+	}
+}
+
+// fiberError logs the denial with the context logger and returns the error returned by the middlewares.
+func (d *permissionDenial) fiberError(ctx *fiber.Ctx, claims *tokenclaims.Token, cfg permissionConfig) error {
+	d.details(denialLog(ctx, claims, d.reason)).Msg("permission denied")
+	return fiber.NewError(cfg.deniedStatus(), d.message)
+}
+
+// denialLog starts a warning log event for a failed permission check with the reason, the token subject and asset.
+func denialLog(ctx *fiber.Ctx, claims *tokenclaims.Token, reason string) *zerolog.Event {
+	return zerolog.Ctx(ctx.UserContext()).Warn().
+		Str("denyReason", reason).
+		Str("subject", claims.Subject).
+		Str("asset", claims.Asset).
+		Str("httpPath", ctx.Path())
+}
+
+// allOfDenial returns a denial if any of the required permissions is not granted.
+func allOfDenial(granted, required []string) *permissionDenial {
+	var missing []string
+	for _, v := range required {
+		if !slices.Contains(granted, v) {
+			missing = append(missing, v)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	return &permissionDenial{
+		reason:  denyReasonMissingPermissions,
+		message: "Unauthorized! Token does not contain required privileges",
+		details: func(e *zerolog.Event) *zerolog.Event { return e.Strs("missingPermissions", missing) },
+	}
+}
+
+// oneOfDenial returns the first granted permission of permissions, or a denial if none of them is granted.
+func oneOfDenial(granted, permissions []string) (string, *permissionDenial) {
+	for _, v := range permissions {
+		if slices.Contains(granted, v) {
+			return v, nil
+		}
+	}
+	return "", &permissionDenial{
+		reason:  denyReasonMissingPermissions,
+		message: "Unauthorized! Token does not contain any of the required privileges",
+		details: func(e *zerolog.Event) *zerolog.Event { return e.Strs("requiredOneOf", permissions) },
+	}
+}
+
+// assetDenial returns a denial if the token asset is not the token ID, if not nil, of one of the contracts.
+func assetDenial(claims *tokenclaims.Token, contracts []common.Address, tokenID *big.Int) *permissionDenial {
 	assetDID, err := cloudevent.DecodeERC721DID(claims.Asset)
 	if err != nil {
-		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! invalid asset")
+		return &permissionDenial{
+			reason:  denyReasonInvalidAsset,
+			message: "Unauthorized! invalid asset",
+			details: func(e *zerolog.Event) *zerolog.Event { return e.AnErr("assetError", err) },
+		}
 	}
 
 	if tokenID != nil && assetDID.TokenID.Cmp(tokenID) != 0 {
-		return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! mismatch token Id provided")
+		return &permissionDenial{
+			reason:  denyReasonTokenIDMismatch,
+			message: "Unauthorized! mismatch token Id provided",
+			details: func(e *zerolog.Event) *zerolog.Event {
+				return e.Str("assetTokenId", assetDID.TokenID.String()).Str("requestedTokenId", tokenID.String())
+			},
+		}
 	}
-	if assetDID.ContractAddress != contract {
-		return fiber.NewError(fiber.StatusUnauthorized, fmt.Sprintf("Provided token is for the wrong contract: %s", assetDID.ContractAddress))
+	if !slices.Contains(contracts, assetDID.ContractAddress) {
+		message := fmt.Sprintf("Provided token is for the wrong contract: %s", assetDID.ContractAddress)
+		if len(contracts) > 1 {
+			message = fmt.Sprintf("Unauthorized! contract %s is not permitted", assetDID.ContractAddress)
+		}
+		return &permissionDenial{
+			reason:  denyReasonContractMismatch,
+			message: message,
+			details: func(e *zerolog.Event) *zerolog.Event {
+				permitted := make([]string, len(contracts))
+				for i, contract := range contracts {
+					permitted[i] = contract.Hex()
+				}
+				return e.Str("assetContract", assetDID.ContractAddress.Hex()).
+					Uint64("assetChainId", assetDID.ChainID).
+					Strs("permittedContracts", permitted)
+			},
+		}
+	}
+	return nil
+}
+
+// validateTokenIDAndAddress checks that the token asset is the token ID, if not nil, of one of the contracts.
+// A failed check is logged with the context logger.
+func validateTokenIDAndAddress(ctx *fiber.Ctx, contracts []common.Address, tokenID *big.Int, claims *tokenclaims.Token, cfg permissionConfig) error {
+	if denial := assetDenial(claims, contracts, tokenID); denial != nil {
+		return denial.fiberError(ctx, claims, cfg)
 	}
 	return nil
 }
 
 // GetTokenClaim gets the token claim from the fiber context.
+// It returns ErrTokenNotFound if the request has no validated token.
 func GetTokenClaim(ctx *fiber.Ctx) (*tokenclaims.Token, error) {
 	token, ok := ctx.Locals("user").(*jwt.Token)
 	if !ok {
-		return nil, fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! Internal server error while getting token")
+		return nil, ErrTokenNotFound
 	}
 	claim, ok := token.Claims.(*tokenclaims.Token)
 	if !ok {
@@ -143,19 +392,29 @@ func GetTokenClaim(ctx *fiber.Ctx) (*tokenclaims.Token, error) {
 	return claim, nil
 }
 
-func getTokenID(c *fiber.Ctx, tokenIDParam string) (*big.Int, error) {
+// getTokenID parses the token ID path parameter. A malformed token ID is a 401, or a 400 with WithStrictStatusCodes.
+func getTokenID(c *fiber.Ctx, tokenIDParam string, cfg permissionConfig) (*big.Int, error) {
 	tokenIDStr := c.Params(tokenIDParam)
 	tokenID, ok := big.NewInt(0).SetString(tokenIDStr, 10)
 	if !ok {
-		return nil, fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! invalid token ID")
+		return nil, malformedParamError(cfg, "invalid token ID")
 	}
 	return tokenID, nil
 }
 
-func getEthAddress(c *fiber.Ctx, contractParam string) (common.Address, error) {
+// getEthAddress parses the address path parameter. A malformed address is a 401, or a 400 with WithStrictStatusCodes.
+func getEthAddress(c *fiber.Ctx, contractParam string, cfg permissionConfig) (common.Address, error) {
 	contractStr := c.Params(contractParam)
 	if !common.IsHexAddress(contractStr) {
-		return common.Address{}, fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! invalid contract")
+		return common.Address{}, malformedParamError(cfg, "invalid contract")
 	}
 	return common.HexToAddress(contractStr), nil
 }
+
+// malformedParamError returns the error of a malformed path parameter.
+func malformedParamError(cfg permissionConfig, message string) error {
+	if cfg.strictStatus {
+		return fiber.NewError(fiber.StatusBadRequest, "Bad request! "+message)
+	}
+	return fiber.NewError(fiber.StatusUnauthorized, "Unauthorized! "+message)
+}
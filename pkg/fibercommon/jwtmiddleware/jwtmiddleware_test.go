@@ -1,21 +1,29 @@
 package jwtmiddleware
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
-	"crypto/rsa"
-	"encoding/hex"
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"net/http"
 	"net/http/httptest"
 	"testing"
 	"time"
 
+	"github.com/DIMO-Network/server-garage/pkg/fibercommon/jwtmiddleware/jwttest"
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
 	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/go-jose/go-jose/v3"
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/require"
 )
 
@@ -25,101 +33,16 @@ const (
 	testAssetDID = "did:erc721:1:0x1234567890123456789012345678901234567890:12345"
 )
 
-type mockAuthServer struct {
-	server *httptest.Server
-	signer jose.Signer
-	jwks   jose.JSONWebKey
-}
-
-func setupAuthServer(t *testing.T) *mockAuthServer {
+// setupAuthServer creates a mock auth server that signs tokens with a new RS256 key.
+func setupAuthServer(t *testing.T) *jwttest.MockAuthServer {
 	t.Helper()
-
-	// Generate RSA key
-	sk, err := rsa.GenerateKey(rand.Reader, 2048)
-	if err != nil {
-		t.Fatalf("Failed to generate RSA key: %v", err)
-	}
-
-	// Generate key ID
-	b := make([]byte, 20)
-	if _, err := rand.Read(b); err != nil {
-		t.Fatalf("Failed to generate key ID: %v", err)
-	}
-	keyID := hex.EncodeToString(b)
-
-	// Create JWK
-	jwk := jose.JSONWebKey{
-		Key:       sk.Public(),
-		KeyID:     keyID,
-		Algorithm: string(jose.RS256),
-		Use:       "sig",
-	}
-
-	// Create signer
-	sig, err := jose.NewSigner(jose.SigningKey{
-		Algorithm: jose.RS256,
-		Key:       sk,
-	}, &jose.SignerOptions{
-		ExtraHeaders: map[jose.HeaderKey]any{
-			"kid": keyID,
-		},
-	})
-	if err != nil {
-		t.Fatalf("Failed to create signer: %v", err)
-	}
-
-	auth := &mockAuthServer{
-		signer: sig,
-		jwks:   jwk,
-	}
-
-	// Create test server with only JWKS endpoint
-	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/keys" {
-			http.NotFound(w, r)
-			return
-		}
-		err := json.NewEncoder(w).Encode(jose.JSONWebKeySet{
-			Keys: []jose.JSONWebKey{jwk},
-		})
-		if err != nil {
-			http.Error(w, "Failed to encode JWKS", http.StatusInternalServerError)
-		}
-	}))
-
-	auth.server = server
-	return auth
+	return jwttest.NewMockAuthServer(t)
 }
 
-func (m *mockAuthServer) sign(claim *tokenclaims.Token) (string, error) {
-	claim.ExpiresAt = jwt.NewNumericDate(time.Now().Add(1 * time.Hour))
-	claim.IssuedAt = jwt.NewNumericDate(time.Now().Add(-1 * time.Hour))
-	claim.Audience = jwt.ClaimStrings{"dimo.zone"}
-	claim.Issuer = "http://127.0.0.1:3003"
-	b, err := json.Marshal(claim)
-	if err != nil {
-		return "", fmt.Errorf("failed to marshal claims: %w", err)
-	}
-
-	out, err := m.signer.Sign(b)
-	if err != nil {
-		return "", fmt.Errorf("failed to sign claims: %w", err)
-	}
-
-	token, err := out.CompactSerialize()
-	if err != nil {
-		return "", fmt.Errorf("failed to serialize token: %w", err)
-	}
-
-	return token, nil
-}
-
-func (m *mockAuthServer) URL() string {
-	return m.server.URL
-}
-
-func (m *mockAuthServer) Close() {
-	m.server.Close()
+// setupAuthServerWithKey creates a mock auth server that signs tokens with the given algorithm and private key.
+func setupAuthServerWithKey(t *testing.T, alg jose.SignatureAlgorithm, sk crypto.Signer) *jwttest.MockAuthServer {
+	t.Helper()
+	return jwttest.NewMockAuthServerWithKey(t, alg, sk)
 }
 
 // setupTestApp creates a new Fiber app for testing with JWT middleware.
@@ -272,7 +195,7 @@ func TestAllOfPermissions(t *testing.T) {
 			)
 
 			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/test/%s", tt.pathValue), nil)
-			token, err := authServer.sign(tt.claims)
+			token, err := authServer.Sign(tt.claims)
 			require.NoError(t, err)
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 			resp, err := app.Test(req)
@@ -369,7 +292,7 @@ func TestOneOfPermissions(t *testing.T) {
 			)
 
 			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/test/%s", tt.pathValue), nil)
-			token, err := authServer.sign(tt.claims)
+			token, err := authServer.Sign(tt.claims)
 			require.NoError(t, err)
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 			resp, err := app.Test(req)
@@ -465,7 +388,7 @@ func TestAllOfPermissionsAddress(t *testing.T) {
 			)
 
 			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/test/%s", tt.pathValue), nil)
-			token, err := authServer.sign(tt.claims)
+			token, err := authServer.Sign(tt.claims)
 			require.NoError(t, err)
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 			resp, err := app.Test(req)
@@ -542,12 +465,810 @@ func TestOneOfPermissionsAddress(t *testing.T) {
 			)
 
 			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/test/%s", tt.pathValue), nil)
-			token, err := authServer.sign(tt.claims)
+			token, err := authServer.Sign(tt.claims)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestPermissionsAuditLog(t *testing.T) {
+	contract := common.HexToAddress(testContract)
+	authServer := setupAuthServer(t)
+
+	tests := []struct {
+		name       string
+		middleware fiber.Handler
+		expected   string
+	}{
+		{
+			name:       "one of logs matched permission",
+			middleware: OneOfPermissions(contract, "tokenID", []string{"perm1", "perm2"}, WithAuditLog()),
+			expected:   `"matchedPermission":"perm2"`,
+		},
+		{
+			name:       "all of logs required permissions",
+			middleware: AllOfPermissions(contract, "tokenID", []string{"perm2", "perm3"}, WithAuditLog()),
+			expected:   `"requiredPermissions":["perm2","perm3"]`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := zerolog.New(&buf)
+			app := setupTestApp()
+			app.Use(func(c *fiber.Ctx) error {
+				c.SetUserContext(logger.WithContext(context.Background()))
+				return c.Next()
+			})
+			authRoute := app.Use(NewJWTMiddleware(authServer.URL() + "/keys"))
+			authRoute.Get("/test/:tokenID", tt.middleware, func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/test/%s", testTokenID), nil)
+			token, err := authServer.Sign(makeToken(testAssetDID, []string{"perm2", "perm3"}))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusOK, resp.StatusCode)
+			require.Contains(t, buf.String(), tt.expected)
+			require.Contains(t, buf.String(), `"asset":"`+testAssetDID+`"`)
+		})
+	}
+}
+
+func TestPermissionDenialLog(t *testing.T) {
+	contract := common.HexToAddress(testContract)
+	otherContract := common.HexToAddress("0x0000000000000000000000000000000000000001")
+	authServer := setupAuthServer(t)
+
+	tests := []struct {
+		name       string
+		middleware fiber.Handler
+		tokenID    string
+		expected   []string
+	}{
+		{
+			name:       "missing permission",
+			middleware: AllOfPermissions(contract, "tokenID", []string{"perm1", "perm2", "perm3"}),
+			tokenID:    testTokenID,
+			expected:   []string{`"denyReason":"missing_permissions"`, `"missingPermissions":["perm1"]`},
+		},
+		{
+			name:       "none of the permissions",
+			middleware: OneOfPermissions(contract, "tokenID", []string{"perm1", "perm4"}),
+			tokenID:    testTokenID,
+			expected:   []string{`"denyReason":"missing_permissions"`, `"requiredOneOf":["perm1","perm4"]`},
+		},
+		{
+			name:       "token ID mismatch",
+			middleware: AllOfPermissions(contract, "tokenID", []string{"perm2"}),
+			tokenID:    "1",
+			expected:   []string{`"denyReason":"token_id_mismatch"`, `"assetTokenId":"12345"`, `"requestedTokenId":"1"`},
+		},
+		{
+			name:       "contract mismatch",
+			middleware: AllOfPermissions(otherContract, "tokenID", []string{"perm2"}),
+			tokenID:    testTokenID,
+			expected: []string{
+				`"denyReason":"contract_mismatch"`,
+				`"assetContract":"` + contract.Hex() + `"`,
+				`"assetChainId":1`,
+				`"permittedContracts":["` + otherContract.Hex() + `"]`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := zerolog.New(zerolog.MultiLevelWriter(&buf, zerolog.NewTestWriter(t)))
+			app := setupTestApp()
+			app.Use(func(c *fiber.Ctx) error {
+				c.SetUserContext(logger.WithContext(context.Background()))
+				return c.Next()
+			})
+			authRoute := app.Use(NewJWTMiddleware(authServer.JWKSURL()))
+			authRoute.Get("/test/:tokenID", tt.middleware, func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test/"+tt.tokenID, nil)
+			token, err := authServer.Sign(makeToken(testAssetDID, []string{"perm2", "perm3"}))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+			require.Contains(t, buf.String(), `"level":"warn"`)
+			require.Contains(t, buf.String(), `"message":"permission denied"`)
+			for _, expected := range tt.expected {
+				require.Contains(t, buf.String(), expected)
+			}
+		})
+	}
+}
+
+func TestCheckPermissions(t *testing.T) {
+	contract := common.HexToAddress(testContract)
+	tokenID := big.NewInt(12345)
+	claims := makeToken(testAssetDID, []string{"perm1", "perm2"})
+
+	tests := []struct {
+		name    string
+		err     error
+		message string
+	}{
+		{name: "all of granted", err: CheckAllPermissions(claims, contract, tokenID, []string{"perm1", "perm2"})},
+		{name: "one of granted", err: CheckOneOfPermissions(claims, contract, tokenID, []string{"perm2", "perm3"})},
+		{name: "contract only", err: CheckAllPermissions(claims, contract, nil, []string{"perm1"})},
+		{
+			name:    "all of missing",
+			err:     CheckAllPermissions(claims, contract, tokenID, []string{"perm1", "perm3"}),
+			message: "Unauthorized! Token does not contain required privileges",
+		},
+		{
+			name:    "one of missing",
+			err:     CheckOneOfPermissions(claims, contract, tokenID, []string{"perm3"}),
+			message: "Unauthorized! Token does not contain any of the required privileges",
+		},
+		{
+			name:    "token ID mismatch",
+			err:     CheckAllPermissions(claims, contract, big.NewInt(1), []string{"perm1"}),
+			message: "Unauthorized! mismatch token Id provided",
+		},
+		{
+			name:    "wrong contract",
+			err:     CheckOneOfPermissions(claims, common.HexToAddress("0x0000000000000000000000000000000000000001"), tokenID, []string{"perm1"}),
+			message: "Provided token is for the wrong contract: " + contract.Hex(),
+		},
+		{
+			name:    "invalid asset",
+			err:     CheckAllPermissions(makeToken("not-a-did", []string{"perm1"}), contract, tokenID, []string{"perm1"}),
+			message: "Unauthorized! invalid asset",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.message == "" {
+				require.NoError(t, tt.err)
+				return
+			}
+			richErr, ok := richerrors.AsRichError(tt.err)
+			require.True(t, ok)
+			require.Equal(t, fiber.StatusUnauthorized, richErr.Code)
+			require.Equal(t, tt.message, richErr.ExternalMsg)
+		})
+	}
+}
+
+func TestAudienceValidation(t *testing.T) {
+	authServer := setupAuthServer(t)
+
+	tests := []struct {
+		name         string
+		cfg          Config
+		expectedCode int
+	}{
+		{
+			name:         "exact audience match",
+			cfg:          Config{ExactAudience: "dimo.zone"},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			name:         "exact audience near miss",
+			cfg:          Config{ExactAudience: "dimo.zon"},
+			expectedCode: fiber.StatusUnauthorized,
+		},
+		{
+			name:         "audience list intersection",
+			cfg:          Config{Audiences: []string{"other", "dimo.zone"}},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			name:         "audience list no intersection",
+			cfg:          Config{Audiences: []string{"other"}},
+			expectedCode: fiber.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.JWKSetURLs = []string{authServer.URL() + "/keys"}
+			app := setupTestApp()
+			app.Use(NewJWTMiddlewareWithConfig(tt.cfg))
+			app.Get("/test", func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			token, err := authServer.Sign(makeToken(testAssetDID, nil))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestWWWAuthenticate(t *testing.T) {
+	contract := common.HexToAddress(testContract)
+	authServer := setupAuthServer(t)
+	validToken, err := authServer.Sign(makeToken(testAssetDID, []string{"perm1"}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		cfg               Config
+		authorization     string
+		permissions       []string
+		expectedCode      int
+		expectedChallenge string
+	}{
+		{
+			name:              "missing token",
+			expectedCode:      fiber.StatusUnauthorized,
+			expectedChallenge: `Bearer realm="dimo"`,
+		},
+		{
+			name:              "malformed authorization header",
+			authorization:     "Basic dXNlcjpwYXNz",
+			expectedCode:      fiber.StatusBadRequest,
+			expectedChallenge: `Bearer realm="dimo", error="invalid_request"`,
+		},
+		{
+			name:              "invalid token",
+			authorization:     "Bearer not.a.token",
+			expectedCode:      fiber.StatusUnauthorized,
+			expectedChallenge: `Bearer realm="dimo", error="invalid_token"`,
+		},
+		{
+			name:              "invalid audience",
+			cfg:               Config{ExactAudience: "other"},
+			authorization:     "Bearer " + validToken,
+			expectedCode:      fiber.StatusUnauthorized,
+			expectedChallenge: `Bearer realm="dimo", error="invalid_token"`,
+		},
+		{
+			name:              "insufficient permissions",
+			authorization:     "Bearer " + validToken,
+			permissions:       []string{"perm2"},
+			expectedCode:      fiber.StatusUnauthorized,
+			expectedChallenge: `Bearer realm="dimo", error="insufficient_scope"`,
+		},
+		{
+			name:              "custom realm",
+			cfg:               Config{Realm: "telemetry"},
+			authorization:     "Bearer not.a.token",
+			expectedCode:      fiber.StatusUnauthorized,
+			expectedChallenge: `Bearer realm="telemetry", error="invalid_token"`,
+		},
+		{
+			name:          "granted",
+			authorization: "Bearer " + validToken,
+			permissions:   []string{"perm1"},
+			expectedCode:  fiber.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.JWKSetURLs = []string{authServer.URL() + "/keys"}
+			app := setupTestApp()
+			app.Use(NewJWTMiddlewareWithConfig(tt.cfg))
+			app.Get("/test/:tokenID",
+				AllOfPermissions(contract, "tokenID", tt.permissions),
+				func(c *fiber.Ctx) error {
+					return c.SendStatus(fiber.StatusOK)
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, "/test/"+testTokenID, nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+			require.Equal(t, tt.expectedChallenge, resp.Header.Get(fiber.HeaderWWWAuthenticate))
+		})
+	}
+}
+
+func TestJWTMiddlewareWithValidation(t *testing.T) {
+	authServer := setupAuthServer(t)
+	const issuer = "http://127.0.0.1:3003"
+
+	tests := []struct {
+		name         string
+		cfg          Config
+		expectedCode int
+	}{
+		{
+			name:         "audience and issuer match",
+			cfg:          Config{Audiences: []string{"dimo.zone"}, Issuers: []string{issuer}},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			name:         "issuer in list",
+			cfg:          Config{Issuers: []string{"https://auth.example.com", issuer}},
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			name:         "mismatched audience",
+			cfg:          Config{Audiences: []string{"other.service"}, Issuers: []string{issuer}},
+			expectedCode: fiber.StatusUnauthorized,
+		},
+		{
+			name:         "mismatched exact audience",
+			cfg:          Config{ExactAudience: "other.service"},
+			expectedCode: fiber.StatusUnauthorized,
+		},
+		{
+			name:         "mismatched issuer",
+			cfg:          Config{Audiences: []string{"dimo.zone"}, Issuers: []string{"https://auth.example.com"}},
+			expectedCode: fiber.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.JWKSetURLs = []string{authServer.URL() + "/keys"}
+			app := setupTestApp()
+			app.Use(NewJWTMiddlewareWithValidation(tt.cfg))
+			app.Get("/test", func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			token, err := authServer.Sign(makeToken(testAssetDID, nil))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+		})
+	}
+
+	require.Panics(t, func() {
+		NewJWTMiddlewareWithValidation(Config{JWKSetURLs: []string{authServer.URL() + "/keys"}})
+	})
+}
+
+func TestAllowedAlgorithms(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	esServer := setupAuthServerWithKey(t, jose.ES256, ecKey)
+	rsServer := setupAuthServer(t)
+
+	tests := []struct {
+		name              string
+		server            *jwttest.MockAuthServer
+		allowedAlgorithms []string
+		expectedCode      int
+	}{
+		{
+			name:              "ES256 allowed",
+			server:            esServer,
+			allowedAlgorithms: []string{"RS256", "ES256"},
+			expectedCode:      fiber.StatusOK,
+		},
+		{
+			name:              "ES256 not allowed",
+			server:            esServer,
+			allowedAlgorithms: []string{"RS256"},
+			expectedCode:      fiber.StatusUnauthorized,
+		},
+		{
+			name:              "RS256 not allowed",
+			server:            rsServer,
+			allowedAlgorithms: []string{"ES256"},
+			expectedCode:      fiber.StatusUnauthorized,
+		},
+		{
+			name:         "any algorithm by default",
+			server:       esServer,
+			expectedCode: fiber.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.Use(NewJWTMiddlewareWithConfig(Config{
+				JWKSetURLs:        []string{tt.server.URL() + "/keys"},
+				AllowedAlgorithms: tt.allowedAlgorithms,
+			}))
+			app.Get("/test", func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			token, err := tt.server.Sign(makeToken(testAssetDID, nil))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestOptionalJWTMiddleware(t *testing.T) {
+	authServer := setupAuthServer(t)
+	validToken, err := authServer.Sign(makeToken(testAssetDID, nil))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		authorization string
+		expectedCode  int
+		expectedBody  string
+	}{
+		{
+			name:         "no token",
+			expectedCode: fiber.StatusOK,
+			expectedBody: "anonymous",
+		},
+		{
+			name:          "valid token",
+			authorization: "Bearer " + validToken,
+			expectedCode:  fiber.StatusOK,
+			expectedBody:  testAssetDID,
+		},
+		{
+			name:          "invalid token",
+			authorization: "Bearer not.a.token",
+			expectedCode:  fiber.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp()
+			app.Use(NewOptionalJWTMiddleware(authServer.URL() + "/keys"))
+			app.Get("/test", func(c *fiber.Ctx) error {
+				claims, err := GetTokenClaim(c)
+				if errors.Is(err, ErrTokenNotFound) {
+					return c.SendString("anonymous")
+				}
+				if err != nil {
+					return err
+				}
+				return c.SendString(claims.Asset)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+			if tt.expectedBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestPermissionsMultiContract(t *testing.T) {
+	contracts := []common.Address{
+		common.HexToAddress("0x0000000000000000000000000000000000000001"),
+		common.HexToAddress(testContract),
+	}
+	authServer := setupAuthServer(t)
+
+	tests := []struct {
+		name         string
+		oneOf        bool
+		claims       *tokenclaims.Token
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "all of with allowed contract",
+			claims:       makeToken(testAssetDID, []string{"perm1", "perm2"}),
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			name:         "one of with allowed contract",
+			oneOf:        true,
+			claims:       makeToken("did:erc721:1:0x0000000000000000000000000000000000000001:12345", []string{"perm2"}),
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			name:         "all of with missing permission",
+			claims:       makeToken(testAssetDID, []string{"perm1"}),
+			expectedCode: fiber.StatusUnauthorized,
+		},
+		{
+			name:         "contract not permitted",
+			claims:       makeToken("did:erc721:1:0x0000000000000000000000000000000000000002:12345", []string{"perm1", "perm2"}),
+			expectedCode: fiber.StatusUnauthorized,
+			expectedBody: "Unauthorized! contract 0x0000000000000000000000000000000000000002 is not permitted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp(authServer.URL() + "/keys")
+			permissions := []string{"perm1", "perm2"}
+			middleware := AllOfPermissionsMultiContract(contracts, "tokenID", permissions)
+			if tt.oneOf {
+				middleware = OneOfPermissionsMultiContract(contracts, "tokenID", permissions)
+			}
+			app.Get("/test/:tokenID", middleware, func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusOK)
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/test/"+testTokenID, nil)
+			token, err := authServer.Sign(tt.claims)
 			require.NoError(t, err)
 			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
 			resp, err := app.Test(req)
 			require.NoError(t, err)
 			require.Equal(t, tt.expectedCode, resp.StatusCode)
+			if tt.expectedBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestRequireFreshToken(t *testing.T) {
+	authServer := setupAuthServer(t)
+	app := setupTestApp(authServer.JWKSURL())
+	app.Post("/transfer", RequireFreshToken(15*time.Minute), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name         string
+		issuedAt     time.Time
+		expectedCode int
+	}{
+		// the auth server issues tokens an hour ago by default
+		{name: "default token is too old", expectedCode: fiber.StatusUnauthorized},
+		{name: "fresh token", issuedAt: time.Now().Add(-time.Minute), expectedCode: fiber.StatusOK},
+		{name: "token just past max age", issuedAt: time.Now().Add(-16 * time.Minute), expectedCode: fiber.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := makeToken(testAssetDID, nil)
+			if !tt.issuedAt.IsZero() {
+				claims.IssuedAt = jwt.NewNumericDate(tt.issuedAt)
+			}
+			token, err := authServer.Sign(claims)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, "/transfer", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestRequireFreshTokenOptions(t *testing.T) {
+	authServer := setupAuthServer(t)
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	app := setupTestApp()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(logger.WithContext(context.Background()))
+		return c.Next()
+	})
+	authRoute := app.Use(NewJWTMiddleware(authServer.JWKSURL()))
+	authRoute.Post("/transfer", RequireFreshToken(15*time.Minute, WithRealm("payments"), WithAuditLog()), func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	doRequest := func(issuedAt time.Time) *http.Response {
+		claims := makeToken(testAssetDID, nil)
+		claims.IssuedAt = jwt.NewNumericDate(issuedAt)
+		token, err := authServer.Sign(claims)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, "/transfer", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp
+	}
+
+	resp := doRequest(time.Now().Add(-time.Hour))
+	require.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, `Bearer realm="payments", error="invalid_token"`, resp.Header.Get(fiber.HeaderWWWAuthenticate))
+
+	resp = doRequest(time.Now().Add(-time.Minute))
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Contains(t, buf.String(), `"audit":true`)
+	require.Contains(t, buf.String(), `"message":"fresh token accepted"`)
+}
+
+func TestRequirePermissionsWith(t *testing.T) {
+	contract := common.HexToAddress(testContract)
+	authServer := setupAuthServer(t)
+	validateOrg := ValidateParam("orgId", func(value string, _ *tokenclaims.Token) error {
+		if value != "dimo" {
+			return fiber.NewError(fiber.StatusForbidden, "Unauthorized! organization not permitted")
+		}
+		return nil
+	})
+
+	tests := []struct {
+		name         string
+		path         string
+		claims       *tokenclaims.Token
+		expectedCode int
+		expectedBody string
+	}{
+		{
+			name:         "org and token valid",
+			path:         "/orgs/dimo/vehicles/" + testTokenID,
+			claims:       makeToken(testAssetDID, []string{"perm1"}),
+			expectedCode: fiber.StatusOK,
+		},
+		{
+			name:         "org invalid short circuits",
+			path:         "/orgs/other/vehicles/99999",
+			claims:       makeToken(testAssetDID, nil),
+			expectedCode: fiber.StatusForbidden,
+			expectedBody: "Unauthorized! organization not permitted",
+		},
+		{
+			name:         "token ID mismatch",
+			path:         "/orgs/dimo/vehicles/99999",
+			claims:       makeToken(testAssetDID, []string{"perm1"}),
+			expectedCode: fiber.StatusUnauthorized,
+			expectedBody: "Unauthorized! mismatch token Id provided",
+		},
+		{
+			name:         "missing permission",
+			path:         "/orgs/dimo/vehicles/" + testTokenID,
+			claims:       makeToken(testAssetDID, []string{"perm2"}),
+			expectedCode: fiber.StatusUnauthorized,
+			expectedBody: "Unauthorized! Token does not contain required privileges",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := setupTestApp(authServer.URL() + "/keys")
+			app.Get("/orgs/:orgId/vehicles/:tokenId",
+				RequirePermissionsWith(validateOrg, ValidateTokenID(contract, "tokenId"), ValidateAllOfPermissions("perm1")),
+				func(c *fiber.Ctx) error {
+					return c.SendStatus(fiber.StatusOK)
+				},
+			)
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			token, err := authServer.Sign(tt.claims)
+			require.NoError(t, err)
+			req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedCode, resp.StatusCode)
+			if tt.expectedBody != "" {
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedBody, string(body))
+			}
 		})
 	}
 }
+
+func TestRequirePermissionsWithOptions(t *testing.T) {
+	contract := common.HexToAddress(testContract)
+	authServer := setupAuthServer(t)
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	app := setupTestApp()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(logger.WithContext(context.Background()))
+		return c.Next()
+	})
+	authRoute := app.Use(NewJWTMiddleware(authServer.JWKSURL()))
+	authRoute.Get("/vehicles/:tokenId",
+		RequirePermissionsWithOptions([]PermissionOption{WithRealm("telemetry"), WithAuditLog()}, ValidateTokenID(contract, "tokenId")),
+		func(c *fiber.Ctx) error {
+			return c.SendStatus(fiber.StatusOK)
+		},
+	)
+	token, err := authServer.Sign(makeToken(testAssetDID, []string{"perm1"}))
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, "/vehicles/99999", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+	require.Equal(t, `Bearer realm="telemetry", error="insufficient_scope"`, resp.Header.Get(fiber.HeaderWWWAuthenticate))
+
+	req = httptest.NewRequest(http.MethodGet, "/vehicles/"+testTokenID, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+	require.Contains(t, buf.String(), `"audit":true`)
+	require.Contains(t, buf.String(), `"message":"permission granted"`)
+}
+
+func TestStrictStatusCodes(t *testing.T) {
+	contract := common.HexToAddress(testContract)
+	authServer := setupAuthServer(t)
+	token, err := authServer.Sign(makeToken(testAssetDID, []string{"perm1"}))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name              string
+		path              string
+		expectedCode      int
+		expectedBody      string
+		expectedChallenge string
+	}{
+		{
+			name:              "missing permission",
+			path:              "/vehicles/" + testTokenID,
+			expectedCode:      fiber.StatusForbidden,
+			expectedBody:      "Unauthorized! Token does not contain required privileges",
+			expectedChallenge: `Bearer realm="dimo", error="insufficient_scope"`,
+		},
+		{
+			name:              "token ID mismatch",
+			path:              "/vehicles/99999",
+			expectedCode:      fiber.StatusForbidden,
+			expectedBody:      "Unauthorized! mismatch token Id provided",
+			expectedChallenge: `Bearer realm="dimo", error="insufficient_scope"`,
+		},
+		{
+			name:              "malformed token ID",
+			path:              "/vehicles/abc",
+			expectedCode:      fiber.StatusBadRequest,
+			expectedBody:      "Bad request! invalid token ID",
+			expectedChallenge: `Bearer realm="dimo", error="invalid_request"`,
+		},
+	}
+	handlers := map[string]fiber.Handler{
+		"AllOfPermissions": AllOfPermissions(contract, "tokenId", []string{"perm1", "perm2"}, WithStrictStatusCodes()),
+		"RequirePermissionsWithOptions": RequirePermissionsWithOptions(
+			[]PermissionOption{WithStrictStatusCodes()},
+			ValidateTokenID(contract, "tokenId"), ValidateAllOfPermissions("perm1", "perm2"),
+		),
+	}
+	for handlerName, handler := range handlers {
+		for _, tt := range tests {
+			t.Run(handlerName+"/"+tt.name, func(t *testing.T) {
+				app := setupTestApp(authServer.JWKSURL())
+				app.Get("/vehicles/:tokenId", handler, func(c *fiber.Ctx) error {
+					return c.SendStatus(fiber.StatusOK)
+				})
+				req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+				req.Header.Set("Authorization", "Bearer "+token)
+				resp, err := app.Test(req)
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedCode, resp.StatusCode)
+				require.Equal(t, tt.expectedChallenge, resp.Header.Get(fiber.HeaderWWWAuthenticate))
+				body, err := io.ReadAll(resp.Body)
+				require.NoError(t, err)
+				require.Equal(t, tt.expectedBody, string(body))
+			})
+		}
+	}
+
+	err = CheckAllPermissions(makeToken(testAssetDID, []string{"perm1"}), contract, big.NewInt(12345), []string{"perm2"}, WithStrictStatusCodes())
+	richErr, ok := richerrors.AsRichError(err)
+	require.True(t, ok)
+	require.Equal(t, fiber.StatusForbidden, richErr.Code)
+	require.Equal(t, "FORBIDDEN", richErr.ErrorCode)
+}
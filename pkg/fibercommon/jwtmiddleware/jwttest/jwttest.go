@@ -0,0 +1,151 @@
+// Package jwttest provides a mock auth server for testing routes protected by jwtmiddleware.
+package jwttest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// DefaultAudience is the audience of signed tokens that do not set one.
+	DefaultAudience = "dimo.zone"
+	// DefaultIssuer is the issuer of signed tokens that do not set one.
+	DefaultIssuer = "http://127.0.0.1:3003"
+	// JWKSPath is the path of the JWK Set served by a MockAuthServer.
+	JWKSPath = "/keys"
+)
+
+// MockAuthServer serves a JWK Set and signs tokens with its private key.
+type MockAuthServer struct {
+	server *httptest.Server
+	signer jose.Signer
+	jwk    jose.JSONWebKey
+}
+
+// NewMockAuthServer creates a MockAuthServer that signs tokens with a new RS256 key.
+// The server is closed when the test finishes.
+func NewMockAuthServer(t testing.TB) *MockAuthServer {
+	t.Helper()
+
+	sk, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate RSA key: %v", err)
+	}
+	return NewMockAuthServerWithKey(t, jose.RS256, sk)
+}
+
+// NewMockAuthServerWithKey creates a MockAuthServer that signs tokens with the given algorithm and private key,
+// e.g. jose.ES256 with an *ecdsa.PrivateKey. The server is closed when the test finishes.
+func NewMockAuthServerWithKey(t testing.TB, alg jose.SignatureAlgorithm, sk crypto.Signer) *MockAuthServer {
+	t.Helper()
+
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatalf("Failed to generate key ID: %v", err)
+	}
+	keyID := hex.EncodeToString(b)
+
+	jwk := jose.JSONWebKey{
+		Key:       sk.Public(),
+		KeyID:     keyID,
+		Algorithm: string(alg),
+		Use:       "sig",
+	}
+
+	sig, err := jose.NewSigner(jose.SigningKey{
+		Algorithm: alg,
+		Key:       sk,
+	}, &jose.SignerOptions{
+		ExtraHeaders: map[jose.HeaderKey]any{
+			"kid": keyID,
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create signer: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != JWKSPath {
+			http.NotFound(w, r)
+			return
+		}
+		err := json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{jwk},
+		})
+		if err != nil {
+			http.Error(w, "Failed to encode JWKS", http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return &MockAuthServer{
+		server: server,
+		signer: sig,
+		jwk:    jwk,
+	}
+}
+
+// Sign signs the claims and returns the compact serialized token.
+// The expiry, issued at, audience and issuer claims are set to valid defaults when not set.
+func (m *MockAuthServer) Sign(claims *tokenclaims.Token) (string, error) {
+	if claims.ExpiresAt == nil {
+		claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(1 * time.Hour))
+	}
+	if claims.IssuedAt == nil {
+		claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-1 * time.Hour))
+	}
+	if len(claims.Audience) == 0 {
+		claims.Audience = jwt.ClaimStrings{DefaultAudience}
+	}
+	if claims.Issuer == "" {
+		claims.Issuer = DefaultIssuer
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal claims: %w", err)
+	}
+
+	out, err := m.signer.Sign(b)
+	if err != nil {
+		return "", fmt.Errorf("failed to sign claims: %w", err)
+	}
+
+	token, err := out.CompactSerialize()
+	if err != nil {
+		return "", fmt.Errorf("failed to serialize token: %w", err)
+	}
+
+	return token, nil
+}
+
+// URL returns the base URL of the server.
+func (m *MockAuthServer) URL() string {
+	return m.server.URL
+}
+
+// JWKSURL returns the URL of the JWK Set, to pass to the jwtmiddleware constructors.
+func (m *MockAuthServer) JWKSURL() string {
+	return m.server.URL + JWKSPath
+}
+
+// JWK returns the public JWK of the signing key.
+func (m *MockAuthServer) JWK() jose.JSONWebKey {
+	return m.jwk
+}
+
+// Close shuts down the server. It is also closed when the test finishes.
+func (m *MockAuthServer) Close() {
+	m.server.Close()
+}
@@ -0,0 +1,175 @@
+package jwtmiddleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MicahParks/keyfunc/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+// keySetRetryInterval is how often a KeySet retries fetching JWK Sets that have not been loaded yet.
+var keySetRetryInterval = 5 * time.Second
+
+// refreshHandlerInterval is the minimum interval between refreshes forced through RefreshHandler.
+var refreshHandlerInterval = time.Minute
+
+// KeySet fetches and caches the JWKs used to validate tokens from one or more JWK Set URLs.
+// Unlike NewJWTMiddleware, creating a KeySet does not fail when a JWK Set is unreachable at startup.
+// The fetch is retried in the background and Ready reports when every JWK Set has been loaded,
+// so services can fail readiness until they are able to validate tokens.
+type KeySet struct {
+	jwks *keyfunc.MultipleJWKS
+
+	// refreshMu guards lastHandlerRefresh, the time of the last refresh forced through RefreshHandler.
+	refreshMu          sync.Mutex
+	lastHandlerRefresh time.Time
+}
+
+// NewKeySet creates a new KeySet for the given JWK Set URLs.
+// Background fetching stops when the context is cancelled.
+func NewKeySet(ctx context.Context, jwkSetURLs ...string) (*KeySet, error) {
+	logger := zerolog.Ctx(ctx)
+	multiple := make(map[string]keyfunc.Options, len(jwkSetURLs))
+	for _, url := range jwkSetURLs {
+		multiple[url] = keyfunc.Options{
+			Ctx: ctx,
+			RefreshErrorHandler: func(err error) {
+				logger.Warn().Err(err).Str("jwkSetUrl", url).Msg("failed to refresh JWK set")
+			},
+			RefreshInterval:             time.Hour,
+			RefreshRateLimit:            time.Minute * 5,
+			RefreshTimeout:              time.Second * 10,
+			RefreshUnknownKID:           true,
+			TolerateInitialJWKHTTPError: true,
+		}
+	}
+	jwks, err := keyfunc.GetMultiple(multiple, keyfunc.MultipleOptions{
+		KeySelector: keyfunc.KeySelectorFirst,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create JWK set: %w", err)
+	}
+	keySet := &KeySet{jwks: jwks}
+	go keySet.fetchUntilReady(ctx)
+	return keySet, nil
+}
+
+// Ready returns true once keys have been loaded from every JWK Set URL.
+func (k *KeySet) Ready() bool {
+	return k.CheckReady(context.Background()) == nil
+}
+
+// CheckReady returns an error if keys have not been loaded from every JWK Set URL.
+// It can be used as a monserver readiness check.
+func (k *KeySet) CheckReady(context.Context) error {
+	for url, jwks := range k.jwks.JWKSets() {
+		if jwks.Len() == 0 {
+			return fmt.Errorf("JWK set %s has not been loaded", url)
+		}
+	}
+	return nil
+}
+
+// Refresh forces an immediate refresh of every JWK Set, ignoring the refresh rate limit,
+// and returns the key IDs loaded afterwards. It is useful when the auth server rotates keys out-of-band.
+func (k *KeySet) Refresh(ctx context.Context) ([]string, error) {
+	for url, jwks := range k.jwks.JWKSets() {
+		if err := jwks.Refresh(ctx, keyfunc.RefreshOptions{IgnoreRateLimit: true}); err != nil {
+			return nil, fmt.Errorf("failed to refresh JWK set %s: %w", url, err)
+		}
+	}
+	return k.KeyIDs(), nil
+}
+
+// KeyIDs returns the sorted key IDs of all loaded keys.
+func (k *KeySet) KeyIDs() []string {
+	var kids []string
+	for _, jwks := range k.jwks.JWKSets() {
+		kids = append(kids, jwks.KIDs()...)
+	}
+	slices.Sort(kids)
+	return slices.Compact(kids)
+}
+
+// refreshResponse is the response of the handler returned by RefreshHandler.
+type refreshResponse struct {
+	KeyIDs []string `json:"keyIds"`
+}
+
+// RefreshHandler returns a handler that forces a refresh of the KeySet and responds with the loaded key IDs.
+// Requests must send the token as "Authorization: Bearer <token>", others are rejected with 401, and the
+// refreshes are limited to one per minute, more frequent requests are rejected with 429 and a Retry-After header.
+// It is meant for the debug routes of the monitoring server, e.g.
+// monserver.WithDebugHandler("POST /debug/jwks/refresh", keySet.RefreshHandler(token)).
+// Note that fibercommon.MountMonitoring with enablePprof serves the debug routes on the public app.
+// It panics if the token is empty.
+func (k *KeySet) RefreshHandler(token string) http.Handler {
+	if token == "" {
+		panic("jwtmiddleware: RefreshHandler requires a token")
+	}
+	expected := []byte("Bearer " + token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), expected) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if retryAfter := k.takeHandlerRefresh(); retryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())+1))
+			http.Error(w, "too many requests", http.StatusTooManyRequests)
+			return
+		}
+		kids, err := k.Refresh(r.Context())
+		if err != nil {
+			zerolog.Ctx(r.Context()).Error().Err(err).Msg("failed to refresh JWK sets")
+			http.Error(w, "failed to refresh JWK sets", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(refreshResponse{KeyIDs: kids})
+	})
+}
+
+// takeHandlerRefresh records a refresh through RefreshHandler if refreshHandlerInterval has passed since the last one.
+// Otherwise it returns how long is left until the next refresh is allowed.
+func (k *KeySet) takeHandlerRefresh() time.Duration {
+	k.refreshMu.Lock()
+	defer k.refreshMu.Unlock()
+	if wait := refreshHandlerInterval - time.Since(k.lastHandlerRefresh); wait > 0 {
+		return wait
+	}
+	k.lastHandlerRefresh = time.Now()
+	return 0
+}
+
+// fetchUntilReady retries fetching JWK Sets without keys until all of them are loaded.
+func (k *KeySet) fetchUntilReady(ctx context.Context) {
+	ticker := time.NewTicker(keySetRetryInterval)
+	defer ticker.Stop()
+	for !k.Ready() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, jwks := range k.jwks.JWKSets() {
+			if jwks.Len() == 0 {
+				_ = jwks.Refresh(ctx, keyfunc.RefreshOptions{IgnoreRateLimit: true})
+			}
+		}
+	}
+}
+
+// NewJWTMiddlewareWithKeySet creates a new JWT token middleware that validates the token using the given KeySet
+// and stores the claims in the fiber context.
+func NewJWTMiddlewareWithKeySet(keySet *KeySet) fiber.Handler {
+	return NewJWTMiddlewareWithConfig(Config{KeySet: keySet})
+}
@@ -0,0 +1,131 @@
+package jwtmiddleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/server-garage/pkg/monserver"
+	"github.com/go-jose/go-jose/v3"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeySetReadiness(t *testing.T) {
+	origInterval := keySetRetryInterval
+	keySetRetryInterval = 10 * time.Millisecond
+	t.Cleanup(func() { keySetRetryInterval = origInterval })
+
+	authServer := setupAuthServer(t)
+	defer authServer.Close()
+
+	// JWKS endpoint that is unavailable until keysAvailable is set.
+	var keysAvailable atomic.Bool
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !keysAvailable.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{
+			Keys: []jose.JSONWebKey{authServer.JWK()},
+		})
+	}))
+	defer jwksServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keySet, err := NewKeySet(ctx, jwksServer.URL)
+	require.NoError(t, err)
+	require.False(t, keySet.Ready())
+
+	mux := monserver.NewMonitoringServer(nil, false, monserver.WithReadinessCheck("jwks", keySet.CheckReady))
+	readyStatus := func() int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+	require.Equal(t, http.StatusServiceUnavailable, readyStatus())
+
+	keysAvailable.Store(true)
+	require.Eventually(t, keySet.Ready, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusOK, readyStatus())
+
+	// Tokens can be validated once the keys are loaded.
+	app := setupTestApp()
+	app.Use(NewJWTMiddlewareWithKeySet(keySet))
+	app.Get("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusOK)
+	})
+	token, err := authServer.Sign(makeToken(testAssetDID, []string{"perm1"}))
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+}
+
+func TestKeySetRefresh(t *testing.T) {
+	authServer := setupAuthServer(t)
+	defer authServer.Close()
+
+	rotatedKey := authServer.JWK()
+	rotatedKey.KeyID = "rotated"
+	var rotated atomic.Bool
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := authServer.JWK()
+		if rotated.Load() {
+			key = rotatedKey
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{key}})
+	}))
+	defer jwksServer.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	keySet, err := NewKeySet(ctx, jwksServer.URL)
+	require.NoError(t, err)
+	require.Equal(t, []string{authServer.JWK().KeyID}, keySet.KeyIDs())
+
+	rotated.Store(true)
+	const refreshToken = "secret"
+	handler := keySet.RefreshHandler(refreshToken)
+	mux := monserver.NewMonitoringServer(nil, true, monserver.WithDebugHandler("POST /debug/jwks/refresh", handler))
+	doRefresh := func(h http.Handler, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/debug/jwks/refresh", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	// Requests without the token are rejected before refreshing.
+	require.Equal(t, http.StatusUnauthorized, doRefresh(mux, "").Code)
+	require.Equal(t, http.StatusUnauthorized, doRefresh(mux, "Bearer wrong").Code)
+	require.Equal(t, []string{authServer.JWK().KeyID}, keySet.KeyIDs())
+
+	w := doRefresh(mux, "Bearer "+refreshToken)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"keyIds":["rotated"]}`, w.Body.String())
+	require.Equal(t, []string{"rotated"}, keySet.KeyIDs())
+
+	// Refreshes through the handler are rate limited.
+	w = doRefresh(mux, "Bearer "+refreshToken)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.NotEmpty(t, w.Header().Get("Retry-After"))
+
+	// The handler is not registered when debug endpoints are disabled.
+	mux = monserver.NewMonitoringServer(nil, false, monserver.WithDebugHandler("POST /debug/jwks/refresh", handler))
+	require.NotEqual(t, http.StatusOK, doRefresh(mux, "Bearer "+refreshToken).Code)
+
+	require.Panics(t, func() { keySet.RefreshHandler("") })
+}
@@ -0,0 +1,115 @@
+package jwtmiddleware
+
+import (
+	"errors"
+
+	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gofiber/fiber/v2"
+)
+
+// ParamValidator validates the request, usually one of its path parameters, against the token claims.
+// It returns an error to reject the request.
+type ParamValidator func(c *fiber.Ctx, claims *tokenclaims.Token) error
+
+// RequirePermissionsWith creates a middleware that runs the validators in order against the token claims
+// and rejects the request with the error of the first failing validator.
+// It composes checks for routes with several parameters, e.g. /orgs/:orgId/vehicles/:tokenId.
+func RequirePermissionsWith(validators ...ParamValidator) fiber.Handler {
+	return RequirePermissionsWithOptions(nil, validators...)
+}
+
+// RequirePermissionsWithOptions is like RequirePermissionsWith but takes options as the permission middlewares,
+// e.g. WithRealm and WithAuditLog.
+func RequirePermissionsWithOptions(opts []PermissionOption, validators ...ParamValidator) fiber.Handler {
+	cfg := newPermissionConfig(opts)
+	return func(c *fiber.Ctx) error {
+		c.Locals(permissionConfigKey, cfg)
+		claims, err := GetTokenClaim(c)
+		if err != nil {
+			SetBearerChallenge(c, cfg.realm, ErrorCodeInvalidToken)
+			return err
+		}
+		for _, validate := range validators {
+			if err := validate(c, claims); err != nil {
+				SetBearerChallenge(c, cfg.realm, challengeErrorCode(err))
+				return err
+			}
+		}
+		if cfg.auditLog {
+			auditLog(c, claims).Msg("permission granted")
+		}
+		return c.Next()
+	}
+}
+
+// permissionConfigKey is the key of the permissionConfig of RequirePermissionsWith in the fiber context,
+// which configures the errors of the validators.
+const permissionConfigKey = "permissionConfig"
+
+// validatorConfig returns the permissionConfig of the RequirePermissionsWith middleware running the validator.
+func validatorConfig(c *fiber.Ctx) permissionConfig {
+	cfg, _ := c.Locals(permissionConfigKey).(permissionConfig)
+	return cfg
+}
+
+// challengeErrorCode returns the Bearer error code of a failed validator:
+// invalid_request for a malformed request and insufficient_scope otherwise.
+func challengeErrorCode(err error) string {
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) && fiberErr.Code == fiber.StatusBadRequest {
+		return ErrorCodeInvalidRequest
+	}
+	return ErrorCodeInsufficientScope
+}
+
+// ValidateTokenID returns a ParamValidator that checks the token is for the token ID in the path parameter of the contract.
+func ValidateTokenID(contract common.Address, tokenIDParam string) ParamValidator {
+	return func(c *fiber.Ctx, claims *tokenclaims.Token) error {
+		cfg := validatorConfig(c)
+		tokenID, err := getTokenID(c, tokenIDParam, cfg)
+		if err != nil {
+			return err
+		}
+		return validateTokenIDAndAddress(c, []common.Address{contract}, tokenID, claims, cfg)
+	}
+}
+
+// ValidateAddress returns a ParamValidator that checks the token is for the address in the path parameter.
+func ValidateAddress(addressParam string) ParamValidator {
+	return func(c *fiber.Ctx, claims *tokenclaims.Token) error {
+		cfg := validatorConfig(c)
+		ethAddress, err := getEthAddress(c, addressParam, cfg)
+		if err != nil {
+			return err
+		}
+		return validateTokenIDAndAddress(c, []common.Address{ethAddress}, nil, claims, cfg)
+	}
+}
+
+// ValidateParam returns a ParamValidator that calls validate with the value of the path parameter.
+func ValidateParam(param string, validate func(value string, claims *tokenclaims.Token) error) ParamValidator {
+	return func(c *fiber.Ctx, claims *tokenclaims.Token) error {
+		return validate(c.Params(param), claims)
+	}
+}
+
+// ValidateAllOfPermissions returns a ParamValidator that checks the token contains all the permissions.
+func ValidateAllOfPermissions(permissions ...string) ParamValidator {
+	return func(c *fiber.Ctx, claims *tokenclaims.Token) error {
+		if denial := allOfDenial(claims.Permissions, permissions); denial != nil {
+			return denial.fiberError(c, claims, validatorConfig(c))
+		}
+		return nil
+	}
+}
+
+// ValidateOneOfPermissions returns a ParamValidator that checks the token contains any of the permissions.
+func ValidateOneOfPermissions(permissions ...string) ParamValidator {
+	return func(c *fiber.Ctx, claims *tokenclaims.Token) error {
+		if _, denial := oneOfDenial(claims.Permissions, permissions); denial != nil {
+			return denial.fiberError(c, claims, validatorConfig(c))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,27 @@
+package fibercommon
+
+import (
+	"github.com/DIMO-Network/server-garage/pkg/monserver"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+)
+
+// MountMonitoring registers the endpoints of the monitoring server on the app, for deployments that serve
+// the API and the monitoring endpoints on a single port: GET /health, GET /ready, their /livez and /readyz
+// aliases and GET /metrics, and when enablePprof is true the pprof profiles and the other /debug endpoints,
+// see monserver.NewMonitoringServer. Since the app is usually public, enablePprof exposes /debug publicly,
+// so only enable it when the app is not reachable from outside or /debug is blocked at the ingress.
+// The options configure the endpoints as for the monitoring server, e.g. monserver.WithReadinessCheck,
+// except monserver.WithPathPrefix, since the routes are registered on the app at fixed paths.
+// Register the routes before any catch-all route or middleware, such as authentication, that should not apply to them.
+func MountMonitoring(app *fiber.App, enablePprof bool, opts ...monserver.Option) {
+	handler := adaptor.HTTPHandler(monserver.NewMonitoringServer(nil, enablePprof, opts...))
+	app.Get("/health", handler)
+	app.Get("/ready", handler)
+	app.Get("/livez", handler)
+	app.Get("/readyz", handler)
+	app.Get("/metrics", handler)
+	if enablePprof {
+		app.All("/debug/*", handler)
+	}
+}
@@ -0,0 +1,176 @@
+package fibercommon
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DIMO-Network/server-garage/pkg/fibercommon/jwtmiddleware"
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// RejectReasonRateLimit is the reject reason of requests over a rate limit.
+const RejectReasonRateLimit = "rate_limit"
+
+// LimiterStore keeps the rate limit state of each key. Implementations must be safe for concurrent use.
+// MemoryLimiterStore keeps the state in memory, a shared store such as Redis can be used to limit across replicas.
+type LimiterStore interface {
+	// Take records a request for the key, allowing limit requests per window.
+	// It reports whether the request is allowed and, if not, how long until the next request is allowed.
+	Take(ctx context.Context, key string, limit int, window time.Duration) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// MemoryLimiterStore is an in-memory LimiterStore using a token bucket per key.
+// Buckets that are full again are removed periodically, so memory is bounded by the keys active within a window.
+// A store should only be shared by middlewares with the same limit and window.
+type MemoryLimiterStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+// tokenBucket holds the tokens left for a key at the time of the last request.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewMemoryLimiterStore creates an empty MemoryLimiterStore.
+func NewMemoryLimiterStore() *MemoryLimiterStore {
+	return &MemoryLimiterStore{
+		buckets: make(map[string]*tokenBucket),
+		now:     time.Now,
+	}
+}
+
+// Take implements LimiterStore. Each key starts with limit tokens that refill evenly over the window.
+func (s *MemoryLimiterStore) Take(_ context.Context, key string, limit int, window time.Duration) (bool, time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	capacity := float64(limit)
+	rate := capacity / window.Seconds()
+	if now.Sub(s.lastSweep) > window {
+		s.sweep(now, rate, capacity)
+		s.lastSweep = now
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: capacity, last: now}
+		s.buckets[key] = bucket
+	}
+	bucket.tokens = min(capacity, bucket.tokens+now.Sub(bucket.last).Seconds()*rate)
+	bucket.last = now
+	if bucket.tokens < 1 {
+		retryAfter := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+		return false, retryAfter, nil
+	}
+	bucket.tokens--
+	return true, 0, nil
+}
+
+// sweep removes the buckets that have refilled to capacity, which behave like new buckets.
+func (s *MemoryLimiterStore) sweep(now time.Time, rate, capacity float64) {
+	for key, bucket := range s.buckets {
+		if bucket.tokens+now.Sub(bucket.last).Seconds()*rate >= capacity {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// RateLimitByIP creates a middleware that allows limit requests per window from each source IP and rejects
+// the rest with 429 and a Retry-After header. It is meant to protect unauthenticated routes and the
+// authentication itself from brute force, so it should be registered before NewJWTMiddleware.
+// Forwarded headers are only honored from the trusted proxies, and the source IP is the right-most X-Forwarded-For
+// entry that is not a trusted proxy, so the entries a client prepends to the header do not change its limit.
+// Unlike ContextLoggerConfig.TrustedProxies, no proxy is trusted when none are given.
+// If the store fails, the request is allowed and the error is logged.
+func RateLimitByIP(limit int, window time.Duration, store LimiterStore, trustedProxies ...netip.Prefix) fiber.Handler {
+	rejectedRequests := rejectedRequestsCounter(nil)
+	return func(c *fiber.Ctx) error {
+		return rateLimit(c, store, rejectedRequests, "ip:"+rateLimitSourceIP(c, trustedProxies), limit, window)
+	}
+}
+
+// RateLimitConfig configures the middleware created by NewRateLimitMiddleware.
+type RateLimitConfig struct {
+	// Store keeps the rate limit state. Defaults to a new MemoryLimiterStore.
+	Store LimiterStore
+	// TrustedProxies are the proxies whose forwarded headers are honored for the source IP of anonymous requests.
+	// No proxy is trusted when empty, see RateLimitByIP.
+	TrustedProxies []netip.Prefix
+	// Registerer registers the http_requests_rejected_total counter when the middleware is created.
+	// Defaults to prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+// RateLimitMiddleware creates a middleware that allows limit requests per window from each caller and rejects
+// the rest with 429 and a Retry-After header. Authenticated callers are keyed by the subject of the token,
+// their Ethereum address, and anonymous callers by source IP, so it should be registered after the JWT middleware.
+// The state is kept in a new MemoryLimiterStore, use NewRateLimitMiddleware for a shared store.
+func RateLimitMiddleware(limit int, window time.Duration) fiber.Handler {
+	return NewRateLimitMiddleware(limit, window, RateLimitConfig{})
+}
+
+// NewRateLimitMiddleware creates a RateLimitMiddleware with the given configuration.
+func NewRateLimitMiddleware(limit int, window time.Duration, cfg RateLimitConfig) fiber.Handler {
+	store := cfg.Store
+	if store == nil {
+		store = NewMemoryLimiterStore()
+	}
+	rejectedRequests := rejectedRequestsCounter(cfg.Registerer)
+	return func(c *fiber.Ctx) error {
+		return rateLimit(c, store, rejectedRequests, callerKey(c, cfg.TrustedProxies), limit, window)
+	}
+}
+
+// callerKey returns the rate limit key of the caller: the token subject if authenticated, the source IP otherwise.
+func callerKey(c *fiber.Ctx, trustedProxies []netip.Prefix) string {
+	if claims, err := jwtmiddleware.GetTokenClaim(c); err == nil && claims.Subject != "" {
+		return "sub:" + strings.ToLower(claims.Subject)
+	}
+	return "ip:" + rateLimitSourceIP(c, trustedProxies)
+}
+
+// rateLimitSourceIP returns the source IP of the request for rate limiting.
+// The remote address is used unless the peer is one of the trusted proxies, which must be given explicitly.
+// Unlike the source IP of the logs, the X-Forwarded-For header is walked from the right, see untrustedForwardedForIP.
+func rateLimitSourceIP(c *fiber.Ctx, trustedProxies []netip.Prefix) string {
+	if len(trustedProxies) == 0 || !isTrustedPeer(c, trustedProxies) {
+		return c.IP()
+	}
+	if sourceIP := untrustedForwardedForIP(c.Get(fiber.HeaderXForwardedFor), trustedProxies); sourceIP != "" {
+		return sourceIP
+	}
+	if addr, err := netip.ParseAddr(strings.TrimSpace(c.Get("X-Real-IP"))); err == nil {
+		return addr.String()
+	}
+	return c.IP()
+}
+
+// rateLimit takes a request for the key from the store and continues the chain if it is allowed.
+// Rejections are counted in rejectedRequests.
+func rateLimit(c *fiber.Ctx, store LimiterStore, rejectedRequests *prometheus.CounterVec, key string, limit int, window time.Duration) error {
+	allowed, retryAfter, err := store.Take(c.UserContext(), key, limit, window)
+	if err != nil {
+		zerolog.Ctx(c.UserContext()).Error().Err(err).Msg("failed to check rate limit, allowing request")
+		return c.Next()
+	}
+	if !allowed {
+		logRejection(c, rejectedRequests, RejectReasonRateLimit)
+		return richerrors.Error{
+			Code:        fiber.StatusTooManyRequests,
+			ExternalMsg: "Too many requests",
+			RetryAfter:  retryAfter,
+			ErrorCode:   "TOO_MANY_REQUESTS",
+		}
+	}
+	return c.Next()
+}
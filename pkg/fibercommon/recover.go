@@ -0,0 +1,30 @@
+package fibercommon
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+// RecoverMiddleware recovers panics in the following handlers and logs the panic value and stack trace with the user context logger.
+// The panic is returned as a richerrors.Error with code 500 so ErrorHandler renders a CodedResponse without the panic details.
+// It should be registered after ContextLoggerMiddleware so the log includes the request metadata.
+func RecoverMiddleware(c *fiber.Ctx) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			zerolog.Ctx(c.UserContext()).Error().
+				Str("panic", fmt.Sprint(r)).
+				Bytes("stack", debug.Stack()).
+				Msg("recovered from panic in http handler")
+			err = richerrors.Error{
+				Code:        fiber.StatusInternalServerError,
+				ExternalMsg: defaultErrorMessage,
+				Err:         fmt.Errorf("panic: %v", r),
+			}
+		}
+	}()
+	return c.Next()
+}
@@ -0,0 +1,133 @@
+package fibercommon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// RejectReasonBodyLimit is the reject reason of requests with a body larger than the configured limit.
+const RejectReasonBodyLimit = "body_limit"
+
+// defaultRejectedRequests is the rejected requests counter of the default registerer.
+// It is registered on first use instead of at package initialization.
+var defaultRejectedRequests = sync.OnceValue(func() *prometheus.CounterVec {
+	return newRejectedRequests(prometheus.DefaultRegisterer)
+})
+
+// rejectedRequestsCounter returns the rejected requests counter of the registerer,
+// or of the default registerer if reg is nil.
+func rejectedRequestsCounter(reg prometheus.Registerer) *prometheus.CounterVec {
+	if reg == nil {
+		return defaultRejectedRequests()
+	}
+	return newRejectedRequests(reg)
+}
+
+// newRejectedRequests registers the http_requests_rejected_total counter with the registerer.
+// If it is already registered, the existing counter is returned instead.
+func newRejectedRequests(reg prometheus.Registerer) *prometheus.CounterVec {
+	counter := prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "http_requests_rejected_total",
+			Help: "Total number of requests rejected by protective middlewares, categorized by reason.",
+		},
+		[]string{"reason"},
+	)
+	if err := reg.Register(counter); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			if existing, ok := alreadyRegistered.ExistingCollector.(*prometheus.CounterVec); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return counter
+}
+
+// LogRejection logs a request rejected by a protective middleware, such as a body size limit,
+// at warn level with the reason as rejectReason and increments the http_requests_rejected_total counter
+// of the default registerer, which is registered on first use.
+// Middlewares that limit requests should call it before returning the rejection error so rejections are
+// visible in logs and metrics and not only in the response.
+func LogRejection(c *fiber.Ctx, reason string) {
+	logRejection(c, defaultRejectedRequests(), reason)
+}
+
+// logRejection logs the rejected request and increments the counter with the reason.
+func logRejection(c *fiber.Ctx, counter *prometheus.CounterVec, reason string) {
+	counter.WithLabelValues(reason).Inc()
+	zerolog.Ctx(c.UserContext()).Warn().
+		Str("rejectReason", reason).
+		Str("httpMethod", c.Method()).
+		Str("httpPath", c.Path()).
+		Msg("request rejected")
+}
+
+// BodyLimitConfig configures the middleware created by NewBodyLimitMiddlewareWithConfig.
+type BodyLimitConfig struct {
+	// Registerer registers the http_requests_rejected_total counter when the middleware is created.
+	// Defaults to prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+// NewBodyLimitMiddleware creates a middleware that rejects requests with a body larger than maxBytes with a
+// richerrors.Error of code 413, rendered by ErrorHandler. Rejections are logged with LogRejection.
+// Requests are rejected early on their Content-Length header. When the app streams request bodies, see the fiber
+// StreamRequestBody config, at most maxBytes+1 bytes of the stream are read, so chunked bodies without a
+// Content-Length cannot exceed the limit either. The fiber BodyLimit config rejects oversized bodies before any
+// handler runs, so this middleware is meant for limits below it, e.g. per route group, or for streamed bodies.
+func NewBodyLimitMiddleware(maxBytes int) fiber.Handler {
+	return NewBodyLimitMiddlewareWithConfig(maxBytes, BodyLimitConfig{})
+}
+
+// NewBodyLimitMiddlewareWithConfig creates a NewBodyLimitMiddleware with the given configuration.
+func NewBodyLimitMiddlewareWithConfig(maxBytes int, cfg BodyLimitConfig) fiber.Handler {
+	rejectedRequests := rejectedRequestsCounter(cfg.Registerer)
+	return func(c *fiber.Ctx) error {
+		withinLimit := c.Request().Header.ContentLength() <= maxBytes
+		if withinLimit {
+			var err error
+			if withinLimit, err = bodyWithinLimit(c, maxBytes); err != nil {
+				return richerrors.Error{
+					Code:        fiber.StatusBadRequest,
+					Err:         err,
+					ExternalMsg: "Failed to read request body",
+				}
+			}
+		}
+		if !withinLimit {
+			logRejection(c, rejectedRequests, RejectReasonBodyLimit)
+			return richerrors.Error{
+				Code:        fiber.StatusRequestEntityTooLarge,
+				ExternalMsg: "Request body too large",
+			}
+		}
+		return c.Next()
+	}
+}
+
+// bodyWithinLimit reports whether the request body is at most maxBytes long.
+// A streamed body is read up to the limit and replaced by the bytes read, so handlers can still read it.
+func bodyWithinLimit(c *fiber.Ctx, maxBytes int) (bool, error) {
+	req := c.Request()
+	if !req.IsBodyStream() {
+		return len(req.Body()) <= maxBytes, nil
+	}
+	body, err := io.ReadAll(io.LimitReader(req.BodyStream(), int64(maxBytes)+1))
+	if err != nil {
+		return false, fmt.Errorf("failed to read request body stream: %w", err)
+	}
+	if len(body) > maxBytes {
+		return false, nil
+	}
+	req.SetBody(body)
+	return true, nil
+}
@@ -0,0 +1,72 @@
+package fibercommon
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// RequestIDKey is the key for the request ID in the fiber context.
+	RequestIDKey = "requestId"
+	// HeaderRequestID is the header used to pass the request ID.
+	HeaderRequestID = fiber.HeaderXRequestID
+	// MaxRequestIDLength is the maximum length in bytes of a request ID passed by the client.
+	MaxRequestIDLength = 128
+)
+
+// RequestIDMiddleware reads the request ID from the X-Request-ID header or generates a UUID when it is absent.
+// A client request ID that is longer than MaxRequestIDLength or is not an HTTP token, e.g. because it contains
+// spaces, quotes or control characters, is replaced by a generated one so it cannot flood or forge log fields.
+// The request ID is stored in the fiber context, set on the response header and added to the logger as requestId.
+// It can be registered before or after ContextLoggerMiddleware.
+func RequestIDMiddleware(c *fiber.Ctx) error {
+	requestID := c.Get(HeaderRequestID)
+	if !validRequestID(requestID) {
+		requestID = utils.UUIDv4()
+	}
+	c.Locals(RequestIDKey, requestID)
+	c.Set(HeaderRequestID, requestID)
+
+	ctx := c.UserContext()
+	if ctx == context.Background() {
+		// if the context is background, use the context from the request so we can get deadlines and cancellation signals
+		ctx = c.Context()
+	}
+	logger := zerolog.Ctx(ctx).With().Str("requestId", requestID).Logger()
+	c.SetUserContext(logger.WithContext(ctx))
+	return c.Next()
+}
+
+// GetRequestID returns the request ID stored by RequestIDMiddleware, or an empty string if there is none.
+func GetRequestID(c *fiber.Ctx) string {
+	requestID, _ := c.Locals(RequestIDKey).(string)
+	return requestID
+}
+
+// validRequestID reports whether the request ID is a non empty HTTP token, see RFC 9110 section 5.6.2,
+// of at most MaxRequestIDLength bytes.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > MaxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(requestID); i++ {
+		if !isTokenChar(requestID[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTokenChar reports whether b is a tchar of RFC 9110.
+func isTokenChar(b byte) bool {
+	switch {
+	case b >= 'a' && b <= 'z', b >= 'A' && b <= 'Z', b >= '0' && b <= '9':
+		return true
+	default:
+		return strings.IndexByte("!#$%&'*+-.^_`|~", b) >= 0
+	}
+}
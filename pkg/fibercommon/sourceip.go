@@ -0,0 +1,130 @@
+package fibercommon
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// SourceIPFromForwardedFor indicates the source IP was taken from the X-Forwarded-For header.
+	SourceIPFromForwardedFor = "X-Forwarded-For"
+	// SourceIPFromRealIP indicates the source IP was taken from the X-Real-IP header.
+	SourceIPFromRealIP = "X-Real-IP"
+	// SourceIPFromRemoteAddr indicates the source IP was taken from the connection's remote address.
+	SourceIPFromRemoteAddr = "remoteAddr"
+)
+
+// ParseTrustedProxies parses a list of CIDR ranges or single IP addresses of trusted proxies.
+func ParseTrustedProxies(proxies []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(proxies))
+	for _, proxy := range proxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+		if strings.Contains(proxy, "/") {
+			prefix, err := netip.ParsePrefix(proxy)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy range %q: %w", proxy, err)
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy address %q: %w", proxy, err)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// getSourceIP returns the source IP of the request and where it was taken from.
+// Forwarded headers are only used when the immediate peer is a trusted proxy.
+func getSourceIP(c *fiber.Ctx, cfg ContextLoggerConfig) (string, string) {
+	if isTrustedPeer(c, cfg.TrustedProxies) {
+		if sourceIP := forwardedForIP(c.Get(fiber.HeaderXForwardedFor), cfg.AllowPrivateForwardedIP); sourceIP != "" {
+			return sourceIP, SourceIPFromForwardedFor
+		}
+		if addr, err := netip.ParseAddr(strings.TrimSpace(c.Get("X-Real-IP"))); err == nil {
+			return addr.String(), SourceIPFromRealIP
+		}
+	}
+	return c.IP(), SourceIPFromRemoteAddr
+}
+
+// isTrustedPeer returns true if the remote address of the connection is in one of the trusted proxy ranges.
+// All peers are trusted when no ranges are given.
+func isTrustedPeer(c *fiber.Ctx, trustedProxies []netip.Prefix) bool {
+	if len(trustedProxies) == 0 {
+		return true
+	}
+	peer, ok := netip.AddrFromSlice(c.Context().RemoteIP())
+	if !ok {
+		return false
+	}
+	return isTrustedAddr(peer.Unmap(), trustedProxies)
+}
+
+// forwardedForIP returns the left-most public IP in an X-Forwarded-For header.
+// If allowPrivate is set or there is no public IP, the left-most valid IP is returned instead.
+func forwardedForIP(header string, allowPrivate bool) string {
+	if header == "" {
+		return ""
+	}
+	var firstIP string
+	for _, entry := range strings.Split(header, ",") {
+		addr, err := netip.ParseAddr(strings.TrimSpace(entry))
+		if err != nil {
+			continue
+		}
+		if allowPrivate || !isPrivateAddr(addr) {
+			return addr.String()
+		}
+		if firstIP == "" {
+			firstIP = addr.String()
+		}
+	}
+	return firstIP
+}
+
+// untrustedForwardedForIP returns the right-most IP in an X-Forwarded-For header that is not one of the trusted proxies.
+// Proxies append the address of their peer, so the entries right of it were added by the trusted proxies and the entries
+// left of it were sent by the client and may be spoofed. If all entries are trusted proxies, the left-most one is returned.
+// An invalid entry ends the walk, since the entries left of it cannot be attributed to a trusted proxy.
+func untrustedForwardedForIP(header string, trustedProxies []netip.Prefix) string {
+	if header == "" {
+		return ""
+	}
+	entries := strings.Split(header, ",")
+	var leftMost string
+	for i := len(entries) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(entries[i]))
+		if err != nil {
+			return ""
+		}
+		addr = addr.Unmap()
+		if !isTrustedAddr(addr, trustedProxies) {
+			return addr.String()
+		}
+		leftMost = addr.String()
+	}
+	return leftMost
+}
+
+// isTrustedAddr returns true if the address is in one of the trusted proxy ranges.
+func isTrustedAddr(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, prefix := range trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func isPrivateAddr(addr netip.Addr) bool {
+	return addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsUnspecified()
+}
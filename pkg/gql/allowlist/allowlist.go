@@ -0,0 +1,168 @@
+// Package allowlist provides a gqlgen extension that only allows operations from a persisted query manifest.
+package allowlist
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/rs/zerolog"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// errOperationNotAllowed is the error of operations that are not in the allowlist.
+var errOperationNotAllowed = errors.New("operation is not in the allowlist")
+
+// Allowlist is a gqlgen extension that rejects operations whose query hash is not in a persisted query manifest.
+// Rejections carry the errorhandler.CodeForbidden code.
+//
+// The manifest is either an Apollo persisted query manifest:
+//
+//	{"format":"apollo-persisted-query-manifest","version":1,"operations":[{"id":"<sha256>","body":"<query>"}]}
+//
+// or a map of query hashes to queries:
+//
+//	{"<sha256>":"<query>"}
+//
+// Hashes are the hex encoded SHA-256 of the query, the same hash used by automatic persisted queries.
+type Allowlist struct {
+	path    string
+	hashes  atomic.Pointer[map[string]struct{}]
+	modTime atomic.Pointer[time.Time]
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = &Allowlist{}
+
+// NewAllowlistFromFile creates a new Allowlist from the persisted query manifest at path.
+func NewAllowlistFromFile(path string) (*Allowlist, error) {
+	allowlist := &Allowlist{path: path}
+	if err := allowlist.Reload(); err != nil {
+		return nil, err
+	}
+	return allowlist, nil
+}
+
+// ExtensionName returns the name of this extension.
+func (a *Allowlist) ExtensionName() string {
+	return "OperationAllowlist"
+}
+
+// Validate validates the GraphQL schema.
+func (a *Allowlist) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext rejects the operation if the hash of its query is not in the allowlist.
+func (a *Allowlist) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	if a.Allowed(opCtx.RawQuery) {
+		return nil
+	}
+	return errorhandler.NewForbiddenErrorWithMsg(ctx, errOperationNotAllowed, "operation not allowed")
+}
+
+// Allowed reports whether the hash of query is in the allowlist.
+func (a *Allowlist) Allowed(query string) bool {
+	sum := sha256.Sum256([]byte(query))
+	_, ok := (*a.hashes.Load())[hex.EncodeToString(sum[:])]
+	return ok
+}
+
+// Reload reads the manifest file again and replaces the allowlist.
+// The previous allowlist is kept if the file cannot be read or parsed.
+func (a *Allowlist) Reload() error {
+	info, err := os.Stat(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to stat allowlist manifest: %w", err)
+	}
+	data, err := os.ReadFile(a.path)
+	if err != nil {
+		return fmt.Errorf("failed to read allowlist manifest: %w", err)
+	}
+	hashes, err := parseManifest(data)
+	if err != nil {
+		return fmt.Errorf("failed to parse allowlist manifest %s: %w", a.path, err)
+	}
+	modTime := info.ModTime()
+	a.hashes.Store(&hashes)
+	a.modTime.Store(&modTime)
+	return nil
+}
+
+// Watch reloads the manifest whenever its modification time changes, checking every interval until ctx is cancelled.
+// Reload errors are logged with the context logger and the previous allowlist is kept.
+func (a *Allowlist) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		info, err := os.Stat(a.path)
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Str("path", a.path).Msg("failed to stat allowlist manifest")
+			continue
+		}
+		if info.ModTime().Equal(*a.modTime.Load()) {
+			continue
+		}
+		if err := a.Reload(); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("path", a.path).Msg("failed to reload allowlist manifest")
+			continue
+		}
+		zerolog.Ctx(ctx).Info().Str("path", a.path).Int("operations", len(*a.hashes.Load())).Msg("reloaded allowlist manifest")
+	}
+}
+
+// apolloManifest is the Apollo persisted query manifest format.
+type apolloManifest struct {
+	Operations []struct {
+		ID   string `json:"id"`
+		Body string `json:"body"`
+	} `json:"operations"`
+}
+
+// parseManifest returns the set of query hashes in the manifest.
+// The hash of the query body is used so the manifest ids do not have to be SHA-256 hashes.
+func parseManifest(data []byte) (map[string]struct{}, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var queries []string
+	if _, ok := raw["operations"]; ok {
+		var manifest apolloManifest
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return nil, err
+		}
+		for _, op := range manifest.Operations {
+			queries = append(queries, op.Body)
+		}
+	} else {
+		for hash, value := range raw {
+			var query string
+			if err := json.Unmarshal(value, &query); err != nil {
+				return nil, fmt.Errorf("invalid query for hash %s: %w", hash, err)
+			}
+			queries = append(queries, query)
+		}
+	}
+	hashes := make(map[string]struct{}, len(queries))
+	for _, query := range queries {
+		sum := sha256.Sum256([]byte(query))
+		hashes[hex.EncodeToString(sum[:])] = struct{}{}
+	}
+	return hashes, nil
+}
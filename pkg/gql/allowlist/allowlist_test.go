@@ -0,0 +1,64 @@
+package allowlist
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// doQuery runs the query against a server using the given extension and returns the response errors.
+func doQuery(t *testing.T, ext graphql.HandlerExtension, query string) gqlerror.List {
+	t.Helper()
+	return gqltest.Query(t, gqltest.NewExecutableSchema(`type Query { hello: String! world: String! }`), query, ext).Errors
+}
+
+func TestAllowlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	manifest := `{"format":"apollo-persisted-query-manifest","version":1,"operations":[{"id":"1","name":"GetHello","type":"query","body":"query GetHello { hello }"}]}`
+	require.NoError(t, os.WriteFile(path, []byte(manifest), 0o600))
+
+	allowlist, err := NewAllowlistFromFile(path)
+	require.NoError(t, err)
+
+	errs := doQuery(t, allowlist, `query GetHello { hello }`)
+	require.Empty(t, errs)
+
+	errs = doQuery(t, allowlist, `query GetWorld { world }`)
+	require.Len(t, errs, 1)
+	require.Equal(t, errorhandler.CodeForbidden, errorhandler.ErrCode(errs[0]))
+}
+
+func TestAllowlistReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"a":"query GetHello { hello }"}`), 0o600))
+
+	allowlist, err := NewAllowlistFromFile(path)
+	require.NoError(t, err)
+	require.True(t, allowlist.Allowed("query GetHello { hello }"))
+	require.False(t, allowlist.Allowed("query GetWorld { world }"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go allowlist.Watch(ctx, 10*time.Millisecond)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"b":"query GetWorld { world }"}`), 0o600))
+	// make sure the modification time changes on file systems with a coarse resolution
+	require.NoError(t, os.Chtimes(path, time.Now(), time.Now().Add(time.Second)))
+	require.Eventually(t, func() bool {
+		return allowlist.Allowed("query GetWorld { world }")
+	}, 5*time.Second, 10*time.Millisecond)
+	require.False(t, allowlist.Allowed("query GetHello { hello }"))
+
+	// an invalid manifest keeps the previous allowlist
+	require.NoError(t, os.WriteFile(path, []byte(`not json`), 0o600))
+	require.Error(t, allowlist.Reload())
+	require.True(t, allowlist.Allowed("query GetWorld { world }"))
+}
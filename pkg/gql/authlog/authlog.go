@@ -0,0 +1,59 @@
+// Package authlog adds the authenticated asset of a Fiber served gqlgen handler to the GraphQL operation logs.
+package authlog
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/fibercommon/jwtmiddleware"
+	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+)
+
+// Extension is a gqlgen extension that adds the assetDid and subject of the token validated by the
+// jwtmiddleware to the context logger used by resolvers.
+// Fiber locals are exposed as context values to net/http handlers run through the fiber adaptor,
+// so the claims stored by the JWT middleware are available to the extension.
+// Operations without a token are not modified.
+// The fields are only added to the logger, not to trace spans: server-garage does not depend on a tracing API,
+// so services that trace their resolvers should add the claims from TokenClaims to their spans themselves.
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = Extension{}
+
+// ExtensionName returns the name of this extension.
+func (Extension) ExtensionName() string {
+	return "AuthLogger"
+}
+
+// Validate validates the GraphQL schema.
+func (Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation adds the token claims to the context logger before the operation is executed.
+func (Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	claims, ok := TokenClaims(ctx)
+	if !ok {
+		return next(ctx)
+	}
+	logger := zerolog.Ctx(ctx).With().
+		Str("assetDid", claims.Asset).
+		Str("subject", claims.Subject).
+		Logger()
+	return next(logger.WithContext(ctx))
+}
+
+// TokenClaims returns the claims of the token stored in the context by the jwtmiddleware, if any.
+func TokenClaims(ctx context.Context) (*tokenclaims.Token, bool) {
+	token, ok := ctx.Value(jwtmiddleware.TokenClaimsKey).(*jwt.Token)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := token.Claims.(*tokenclaims.Token)
+	return claims, ok
+}
@@ -0,0 +1,68 @@
+package authlog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/fibercommon/jwtmiddleware"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/DIMO-Network/token-exchange-api/pkg/tokenclaims"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testAssetDID = "did:erc721:1:0x1234567890123456789012345678901234567890:12345"
+
+func TestExtensionLogsAsset(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	// the request context of the adaptor has no logger, so resolvers use the default context logger
+	prev := zerolog.DefaultContextLogger
+	zerolog.DefaultContextLogger = &logger
+	t.Cleanup(func() { zerolog.DefaultContextLogger = prev })
+
+	es := gqltest.NewExecutableSchema(gqltest.Schema)
+	es.ExecFunc = func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			zerolog.Ctx(ctx).Info().Msg("resolving hello")
+			return &graphql.Response{Data: []byte(`{"hello":"world"}`)}
+		}
+	}
+	srv := gqltest.NewServer(es, Extension{})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		// store the claims like the JWT middleware does
+		c.Locals(jwtmiddleware.TokenClaimsKey, &jwt.Token{Claims: &tokenclaims.Token{
+			CustomClaims:     tokenclaims.CustomClaims{Asset: testAssetDID},
+			RegisteredClaims: jwt.RegisteredClaims{Subject: "0xabc"},
+		}})
+		return c.Next()
+	})
+	app.Post("/query", adaptor.HTTPHandler(srv))
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query":"{ hello }"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	logs := buf.String()
+	assert.Contains(t, logs, `"message":"resolving hello"`)
+	assert.Contains(t, logs, `"assetDid":"`+testAssetDID+`"`)
+	assert.Contains(t, logs, `"subject":"0xabc"`)
+}
+
+func TestTokenClaimsWithoutToken(t *testing.T) {
+	_, ok := TokenClaims(context.Background())
+	assert.False(t, ok)
+}
@@ -1,5 +1,7 @@
 package errorhandler
 
+import "net/http"
+
 const (
 	// CodeUnknown is the code for when an error occurred before your server could attempt to parse the given GraphQL operation.
 	CodeUnknown = "UNKNOWN"
@@ -22,3 +24,51 @@ const (
 	// CodeTooManyRequests is the code for when a user has made too many requests.
 	CodeTooManyRequests = "TOO_MANY_REQUESTS"
 )
+
+// codeHTTPStatus maps error codes to their HTTP status.
+var codeHTTPStatus = map[string]int{
+	CodeUnknown:                 http.StatusInternalServerError,
+	CodeGraphQLParseFailed:      http.StatusBadRequest,
+	CodeGraphQLValidationFailed: http.StatusBadRequest,
+	CodeBadUserInput:            http.StatusBadRequest,
+	CodeBadRequest:              http.StatusBadRequest,
+	CodeInternalServerError:     http.StatusInternalServerError,
+	CodeNotFound:                http.StatusNotFound,
+	CodeUnauthorized:            http.StatusUnauthorized,
+	CodeForbidden:               http.StatusForbidden,
+	CodeTooManyRequests:         http.StatusTooManyRequests,
+}
+
+// HTTPStatusForCode returns the HTTP status for the code, defaulting to 500 for unknown codes.
+func HTTPStatusForCode(code string) int {
+	if status, ok := codeHTTPStatus[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForHTTPStatus returns the code for the HTTP status.
+// Unmapped 4xx statuses return CodeBadRequest, unmapped 5xx statuses return CodeInternalServerError,
+// and any other status returns CodeUnknown.
+func CodeForHTTPStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeBadRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusTooManyRequests:
+		return CodeTooManyRequests
+	}
+	switch {
+	case status >= 400 && status < 500:
+		return CodeBadRequest
+	case status >= 500 && status < 600:
+		return CodeInternalServerError
+	default:
+		return CodeUnknown
+	}
+}
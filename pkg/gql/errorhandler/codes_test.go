@@ -0,0 +1,19 @@
+package errorhandler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPStatusCodeMapping(t *testing.T) {
+	for _, code := range []string{CodeBadRequest, CodeUnauthorized, CodeForbidden, CodeNotFound, CodeTooManyRequests, CodeInternalServerError} {
+		require.Equal(t, code, CodeForHTTPStatus(HTTPStatusForCode(code)), code)
+	}
+	require.Equal(t, http.StatusBadRequest, HTTPStatusForCode(CodeBadUserInput))
+	require.Equal(t, http.StatusInternalServerError, HTTPStatusForCode("SOMETHING_ELSE"))
+	require.Equal(t, CodeBadRequest, CodeForHTTPStatus(http.StatusConflict))
+	require.Equal(t, CodeInternalServerError, CodeForHTTPStatus(http.StatusBadGateway))
+	require.Equal(t, CodeUnknown, CodeForHTTPStatus(http.StatusOK))
+}
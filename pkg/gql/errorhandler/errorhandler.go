@@ -6,26 +6,81 @@ import (
 	"net/http"
 
 	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/logging"
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
 	"github.com/rs/zerolog"
 	"github.com/vektah/gqlparser/v2/gqlerror"
 )
 
+// PresenterConfig configures the error presenter created by NewErrorPresenter.
+type PresenterConfig struct {
+	// LogErrorCauses adds a causes array with the message of each error in the chain to the error log.
+	LogErrorCauses bool
+	// TraceIDFunc extracts a request or trace ID from the context.
+	// When it returns a non-empty ID, the ID is added to the error extensions and the log as traceId.
+	TraceIDFunc func(ctx context.Context) string
+}
+
+// TraceIDFromContextKey returns a TraceIDFunc that reads a string trace ID stored in the context under the given key.
+func TraceIDFromContextKey(key any) func(ctx context.Context) string {
+	return func(ctx context.Context) string {
+		traceID, _ := ctx.Value(key).(string)
+		return traceID
+	}
+}
+
 // ErrorPresenter is a custom error presenter that logs the error and returns a gqlerror.Error.
 func ErrorPresenter(ctx context.Context, err error) *gqlerror.Error {
+	return presentError(ctx, err, PresenterConfig{})
+}
+
+// NewErrorPresenter creates an ErrorPresenter with the given configuration.
+func NewErrorPresenter(cfg PresenterConfig) graphql.ErrorPresenterFunc {
+	return func(ctx context.Context, err error) *gqlerror.Error {
+		return presentError(ctx, err, cfg)
+	}
+}
+
+func presentError(ctx context.Context, err error, cfg PresenterConfig) *gqlerror.Error {
 	if err == nil {
 		return nil
 	}
 	var gqlErr *gqlerror.Error
+	fields, hasFields := richerrors.ValidationFieldsOf(err)
 	if !errors.As(err, &gqlErr) {
-		// If someone incorrectly returns a raw error, do not expose the error message.
-		gqlErr = gqlerror.WrapPath(graphql.GetPath(ctx), err)
-		gqlErr.Message = "internal server error"
+		if richErr, ok := richerrors.AsRichError(err); ok && hasFields {
+			// Validation errors are safe to expose, their external message and fields are meant for clients.
+			gqlErr = NewErrorWithMsg(ctx, err, richErr.ExternalMsg, CodeBadUserInput)
+		} else {
+			// If someone incorrectly returns a raw error, do not expose the error message.
+			gqlErr = gqlerror.WrapPath(graphql.GetPath(ctx), err)
+			gqlErr.Message = "internal server error"
+		}
+	} else if coded, ok := transportError(ctx, gqlErr); ok {
+		gqlErr = coded
+	}
+	if hasFields {
+		if gqlErr.Extensions == nil {
+			gqlErr.Extensions = map[string]interface{}{}
+		}
+		gqlErr.Extensions["validation"] = fields
 	}
-	zerolog.Ctx(ctx).Error().
+	if cfg.TraceIDFunc != nil {
+		if traceID := cfg.TraceIDFunc(ctx); traceID != "" {
+			if gqlErr.Extensions == nil {
+				gqlErr.Extensions = map[string]interface{}{}
+			}
+			gqlErr.Extensions["traceId"] = traceID
+		}
+	}
+	event := zerolog.Ctx(ctx).Error().
 		Err(gqlErr.Err).
 		Str("gqlPath", gqlErr.Path.String()).
-		Fields(gqlErr.Extensions).
-		Msg(gqlErr.Message)
+		Fields(gqlErr.Extensions)
+	if cfg.LogErrorCauses {
+		event = event.Strs("causes", logging.ErrorCauses(gqlErr.Err))
+	}
+	event.Msg(gqlErr.Message)
 	return gqlErr
 }
 
@@ -36,12 +91,30 @@ func NewErrorWithMsg(ctx context.Context, err error, message string, code string
 		Message: message,
 		Path:    graphql.GetPath(ctx),
 		Extensions: map[string]interface{}{
-			"reason": http.StatusText(http.StatusInternalServerError),
+			"reason": http.StatusText(HTTPStatusForCode(code)),
 			"code":   code,
 		},
 	}
 }
 
+// FromRichError converts a rich error of a REST or service layer into a gqlerror.Error.
+// The code is the ErrorCode of the rich error if set, otherwise it is derived from its HTTP status with CodeForHTTPStatus.
+// The message is the ExternalMsg, or the status text if it is empty, and the rich error, with its internal Err, is wrapped.
+func FromRichError(ctx context.Context, richErr richerrors.Error) *gqlerror.Error {
+	status := richErr.HTTPStatus()
+	code := richErr.ErrorCode
+	if code == "" {
+		code = CodeForHTTPStatus(status)
+	}
+	message := richErr.ExternalMsg
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	gqlErr := NewErrorWithMsg(ctx, richErr, message, code)
+	gqlErr.Extensions["reason"] = http.StatusText(status)
+	return gqlErr
+}
+
 // NewInternalErrorWithMsg creates a new internal server error with a message.
 func NewInternalErrorWithMsg(ctx context.Context, err error, message string) *gqlerror.Error {
 	return NewErrorWithMsg(ctx, err, message, CodeInternalServerError)
@@ -67,6 +140,36 @@ func NewUnauthorizedError(ctx context.Context, err error) *gqlerror.Error {
 	return NewUnauthorizedErrorWithMsg(ctx, err, err.Error())
 }
 
+// NewForbiddenErrorWithMsg creates a new forbidden error with a message.
+func NewForbiddenErrorWithMsg(ctx context.Context, err error, message string) *gqlerror.Error {
+	return NewErrorWithMsg(ctx, err, message, CodeForbidden)
+}
+
+// NewForbiddenError creates a new forbidden error.
+func NewForbiddenError(ctx context.Context, err error) *gqlerror.Error {
+	return NewForbiddenErrorWithMsg(ctx, err, err.Error())
+}
+
+// NewNotFoundErrorWithMsg creates a new not found error with a message.
+func NewNotFoundErrorWithMsg(ctx context.Context, err error, message string) *gqlerror.Error {
+	return NewErrorWithMsg(ctx, err, message, CodeNotFound)
+}
+
+// NewNotFoundError creates a new not found error.
+func NewNotFoundError(ctx context.Context, err error) *gqlerror.Error {
+	return NewNotFoundErrorWithMsg(ctx, err, err.Error())
+}
+
+// NewTooManyRequestsErrorWithMsg creates a new too many requests error with a message.
+func NewTooManyRequestsErrorWithMsg(ctx context.Context, err error, message string) *gqlerror.Error {
+	return NewErrorWithMsg(ctx, err, message, CodeTooManyRequests)
+}
+
+// NewTooManyRequestsError creates a new too many requests error.
+func NewTooManyRequestsError(ctx context.Context, err error) *gqlerror.Error {
+	return NewTooManyRequestsErrorWithMsg(ctx, err, err.Error())
+}
+
 // ErrCode returns the code of the gqlerror.Error
 // If the code is not correctly set, it returns an empty string.
 func ErrCode(gqlErr *gqlerror.Error) string {
@@ -0,0 +1,96 @@
+package errorhandler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DIMO-Network/server-garage/pkg/richerrors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+type traceIDKey struct{}
+
+func TestErrorPresenterTraceID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	ctx := context.WithValue(logger.WithContext(context.Background()), traceIDKey{}, "trace-123")
+
+	presenter := NewErrorPresenter(PresenterConfig{TraceIDFunc: TraceIDFromContextKey(traceIDKey{})})
+	gqlErr := presenter(ctx, errors.New("database unavailable"))
+
+	require.Equal(t, "internal server error", gqlErr.Message)
+	require.Equal(t, "trace-123", gqlErr.Extensions["traceId"])
+	require.Contains(t, buf.String(), `"traceId":"trace-123"`)
+}
+
+func TestErrorConstructors(t *testing.T) {
+	ctx := context.Background()
+	err := errors.New("boom")
+	tests := []struct {
+		gqlErr *gqlerror.Error
+		code   string
+		reason string
+	}{
+		{gqlErr: NewForbiddenError(ctx, err), code: CodeForbidden, reason: "Forbidden"},
+		{gqlErr: NewNotFoundError(ctx, err), code: CodeNotFound, reason: "Not Found"},
+		{gqlErr: NewTooManyRequestsError(ctx, err), code: CodeTooManyRequests, reason: "Too Many Requests"},
+		{gqlErr: NewBadRequestError(ctx, err), code: CodeBadRequest, reason: "Bad Request"},
+		{gqlErr: NewInternalErrorWithMsg(ctx, err, "internal"), code: CodeInternalServerError, reason: "Internal Server Error"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			require.Equal(t, tt.code, ErrCode(tt.gqlErr))
+			require.Equal(t, tt.reason, tt.gqlErr.Extensions["reason"])
+		})
+	}
+}
+
+func TestErrorPresenterValidationFields(t *testing.T) {
+	ctx := zerolog.Nop().WithContext(context.Background())
+	fields := map[string]string{"vin": "must be 17 characters"}
+	validationErr := richerrors.NewValidationError("invalid input", fields)
+
+	gqlErr := ErrorPresenter(ctx, validationErr)
+	require.Equal(t, "invalid input", gqlErr.Message)
+	require.Equal(t, CodeBadUserInput, ErrCode(gqlErr))
+	require.Equal(t, fields, gqlErr.Extensions["validation"])
+
+	// A coded gqlerror wrapping the validation error keeps its message and code.
+	gqlErr = ErrorPresenter(ctx, NewBadRequestErrorWithMsg(ctx, validationErr, "bad vehicle"))
+	require.Equal(t, "bad vehicle", gqlErr.Message)
+	require.Equal(t, CodeBadRequest, ErrCode(gqlErr))
+	require.Equal(t, fields, gqlErr.Extensions["validation"])
+}
+
+func TestFromRichError(t *testing.T) {
+	ctx := context.Background()
+	internal := errors.New("vehicle 42 not in database")
+	tests := []struct {
+		richErr richerrors.Error
+		code    string
+		reason  string
+		message string
+	}{
+		{richErr: richerrors.Error{Code: 400, ExternalMsg: "invalid vehicle id", Err: internal}, code: CodeBadRequest, reason: "Bad Request", message: "invalid vehicle id"},
+		{richErr: richerrors.Error{Code: 401, ExternalMsg: "token expired", Err: internal}, code: CodeUnauthorized, reason: "Unauthorized", message: "token expired"},
+		{richErr: richerrors.Error{Code: 404, ExternalMsg: "vehicle not found", Err: internal}, code: CodeNotFound, reason: "Not Found", message: "vehicle not found"},
+		{richErr: richerrors.Error{Code: 500, Err: internal}, code: CodeInternalServerError, reason: "Internal Server Error", message: "Internal Server Error"},
+		{richErr: richerrors.Error{Code: 400, ExternalMsg: "invalid vin", ErrorCode: CodeBadUserInput, Err: internal}, code: CodeBadUserInput, reason: "Bad Request", message: "invalid vin"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			gqlErr := FromRichError(ctx, tt.richErr)
+			require.Equal(t, tt.message, gqlErr.Message)
+			require.Equal(t, tt.code, gqlErr.Extensions["code"])
+			require.Equal(t, tt.reason, gqlErr.Extensions["reason"])
+			require.ErrorIs(t, gqlErr, internal)
+			richErr, ok := richerrors.AsRichError(gqlErr)
+			require.True(t, ok)
+			require.Equal(t, tt.richErr.Code, richErr.Code)
+		})
+	}
+}
@@ -0,0 +1,23 @@
+package errorhandler
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/rs/zerolog"
+)
+
+var _ graphql.RecoverFunc = RecoverFunc
+
+// RecoverFunc is a gqlgen recover function that logs the panic value and stack trace with the context logger.
+// The returned error has the CodeInternalServerError code and does not expose the panic details to the client.
+// Use it with handler.Server.SetRecoverFunc.
+func RecoverFunc(ctx context.Context, panicValue any) error {
+	zerolog.Ctx(ctx).Error().
+		Str("panic", fmt.Sprint(panicValue)).
+		Bytes("stack", debug.Stack()).
+		Msg("recovered from panic in graphql resolver")
+	return NewInternalErrorWithMsg(ctx, fmt.Errorf("panic: %v", panicValue), "internal server error")
+}
@@ -0,0 +1,70 @@
+package errorhandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// transportErrorMessages are the message prefixes of the errors gqlgen transports dispatch when the request body cannot be read or decoded.
+// gqlgen creates those errors with gqlerror.Errorf, so they wrap no typed error, and writes the status code after the errors are presented,
+// so the prefix is the only way to recognize them. The transports append the decoding error and the raw body to the message,
+// which is not returned to clients. TestTransportErrorMessages pins the prefixes against the gqlgen version in go.mod.
+var transportErrorMessages = []string{
+	"json request body could not be decoded",
+	"could not get json request body",
+	"could not read request body",
+	"could not get request body",
+	"could not get form body",
+	"could not cleanup body",
+}
+
+// transportError returns a BAD_REQUEST error for an uncoded gqlgen transport error and reports whether gqlErr is one.
+// The original message is kept in the wrapped error so it is still logged.
+func transportError(ctx context.Context, gqlErr *gqlerror.Error) (*gqlerror.Error, bool) {
+	if ErrCode(gqlErr) != "" || len(gqlErr.Path) != 0 {
+		return nil, false
+	}
+	for _, msg := range transportErrorMessages {
+		if strings.HasPrefix(gqlErr.Message, msg) {
+			coded := NewErrorWithMsg(ctx, errors.New(gqlErr.Message), msg, CodeBadRequest)
+			for k, v := range gqlErr.Extensions {
+				if _, ok := coded.Extensions[k]; !ok {
+					coded.Extensions[k] = v
+				}
+			}
+			return coded, true
+		}
+	}
+	return nil, false
+}
+
+var _ graphql.Transport = UnsupportedTransport{}
+
+// UnsupportedTransport is a catch-all gqlgen transport that rejects requests no other transport supports,
+// such as a POST with an unsupported content type, with a BAD_REQUEST error.
+// By default gqlgen responds to those requests with an uncoded error that bypasses the error presenter.
+// The error is dispatched through the executor so it is presented and logged like all other errors.
+// It supports every request, so it must be added after all other transports with handler.Server.AddTransport.
+type UnsupportedTransport struct{}
+
+// Supports always returns true.
+func (UnsupportedTransport) Supports(*http.Request) bool {
+	return true
+}
+
+// Do responds with a 400 status and a BAD_REQUEST error.
+func (UnsupportedTransport) Do(w http.ResponseWriter, r *http.Request, exec graphql.GraphExecutor) {
+	ctx := r.Context()
+	err := errors.New("transport not supported: " + r.Method + " " + r.Header.Get("Content-Type"))
+	gqlErr := NewBadRequestErrorWithMsg(ctx, err, "unsupported request method or content type")
+	resp := exec.DispatchError(ctx, gqlerror.List{gqlErr})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,109 @@
+package errorhandler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+func TestTransportErrors(t *testing.T) {
+	srv := gqltest.NewServer(gqltest.NewExecutableSchema(gqltest.Schema))
+	srv.AddTransport(UnsupportedTransport{})
+	srv.SetErrorPresenter(ErrorPresenter)
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		code        string
+	}{
+		{name: "malformed json", contentType: "application/json", body: `{"query": "{ hello }"`, code: CodeBadRequest},
+		{name: "unsupported content type", contentType: "text/plain", body: `{ hello }`, code: CodeBadRequest},
+		{name: "invalid query", contentType: "application/json", body: `{"query": "{ hello"}`, code: CodeGraphQLParseFailed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req = req.WithContext(zerolog.New(&buf).WithContext(req.Context()))
+			req.Header.Set("Content-Type", tt.contentType)
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, req)
+
+			var resp struct {
+				Errors gqlerror.List `json:"errors"`
+			}
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			require.Len(t, resp.Errors, 1)
+			require.Equal(t, tt.code, resp.Errors[0].Extensions["code"])
+			require.NotContains(t, resp.Errors[0].Message, tt.body, "the request body must not be returned to the client")
+			require.Contains(t, buf.String(), `"code":"`+tt.code+`"`)
+		})
+	}
+}
+
+// errReader is a request body that cannot be read.
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
+
+// TestTransportErrorMessages pins the message prefixes of transportErrorMessages against the gqlgen transports,
+// so a gqlgen upgrade that changes them fails here instead of returning uncoded errors to clients.
+func TestTransportErrorMessages(t *testing.T) {
+	tests := []struct {
+		name        string
+		transport   graphql.Transport
+		contentType string
+		accept      string
+		body        io.Reader
+		msg         string
+	}{
+		{name: "post malformed json", transport: transport.POST{}, contentType: "application/json", body: strings.NewReader(`{"query"`), msg: "json request body could not be decoded"},
+		{name: "post unreadable body", transport: transport.POST{}, contentType: "application/json", body: errReader{}, msg: "could not read request body"},
+		{name: "sse unreadable body", transport: transport.SSE{}, contentType: "application/json", accept: "text/event-stream", body: errReader{}, msg: "could not get json request body"},
+		{name: "graphql unreadable body", transport: transport.GRAPHQL{}, contentType: "application/graphql", body: errReader{}, msg: "could not get request body"},
+		{name: "graphql invalid encoding", transport: transport.GRAPHQL{}, contentType: "application/graphql", body: strings.NewReader(`%7B%zz`), msg: "could not cleanup body"},
+		{name: "form unreadable body", transport: transport.UrlEncodedForm{}, contentType: "application/x-www-form-urlencoded", body: errReader{}, msg: "could not get form body"},
+		{name: "form invalid encoding", transport: transport.UrlEncodedForm{}, contentType: "application/x-www-form-urlencoded", body: strings.NewReader(`query=%7B%zz`), msg: "could not cleanup body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var presented []*gqlerror.Error
+			srv := handler.New(gqltest.NewExecutableSchema(gqltest.Schema))
+			srv.AddTransport(tt.transport)
+			srv.SetErrorPresenter(func(ctx context.Context, err error) *gqlerror.Error {
+				gqlErr := ErrorPresenter(ctx, err)
+				presented = append(presented, gqlErr)
+				return gqlErr
+			})
+
+			req := httptest.NewRequest(http.MethodPost, "/", tt.body)
+			req = req.WithContext(zerolog.Nop().WithContext(req.Context()))
+			req.Header.Set("Content-Type", tt.contentType)
+			if tt.accept != "" {
+				req.Header.Set("Accept", tt.accept)
+			}
+			srv.ServeHTTP(httptest.NewRecorder(), req)
+
+			require.Len(t, presented, 1)
+			require.Equal(t, CodeBadRequest, presented[0].Extensions["code"])
+			require.Equal(t, tt.msg, presented[0].Message)
+		})
+	}
+}
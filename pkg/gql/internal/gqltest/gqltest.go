@@ -0,0 +1,85 @@
+// Package gqltest provides a gqlgen server fixture for testing the extensions of the gql packages.
+package gqltest
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"github.com/vektah/gqlparser/v2"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// Schema is the default schema of NewExecutableSchema.
+const Schema = `type Query { hello: String! }`
+
+// NewExecutableSchema creates an executable schema for the schema source that responds {"hello":"world"} to every operation.
+// Replace its ExecFunc to respond differently.
+func NewExecutableSchema(input string) *graphql.ExecutableSchemaMock {
+	return &graphql.ExecutableSchemaMock{
+		SchemaFunc: func() *ast.Schema {
+			return gqlparser.MustLoadSchema(&ast.Source{
+				Name:  "test.graphqls",
+				Input: input,
+			})
+		},
+		ComplexityFunc: func(ctx context.Context, typeName, fieldName string, childComplexity int, args map[string]any) (int, bool) {
+			return 0, false
+		},
+		ExecFunc: func(ctx context.Context) graphql.ResponseHandler {
+			return func(ctx context.Context) *graphql.Response {
+				return &graphql.Response{Data: []byte(`{"hello":"world"}`)}
+			}
+		},
+	}
+}
+
+// NewServer creates a gqlgen handler for the executable schema that serves JSON POST requests with the extensions.
+func NewServer(es graphql.ExecutableSchema, exts ...graphql.HandlerExtension) *handler.Server {
+	srv := handler.New(es)
+	srv.AddTransport(transport.POST{})
+	for _, ext := range exts {
+		srv.Use(ext)
+	}
+	return srv
+}
+
+// Response is the decoded response of a GraphQL request.
+type Response struct {
+	StatusCode int             `json:"-"`
+	Data       json.RawMessage `json:"data"`
+	Errors     gqlerror.List   `json:"errors"`
+}
+
+// Do posts the query with the variables to the handler as JSON and returns the decoded response.
+func Do(t testing.TB, h http.Handler, query string, variables map[string]any) Response {
+	t.Helper()
+
+	body, err := json.Marshal(map[string]any{"query": query, "variables": variables})
+	if err != nil {
+		t.Fatalf("Failed to encode request: %v", err)
+	}
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	resp := Response{StatusCode: w.Code}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("Failed to decode response %q: %v", w.Body.String(), err)
+	}
+	return resp
+}
+
+// Query runs the query against a server for the executable schema with the extensions and returns the decoded response.
+func Query(t testing.TB, es graphql.ExecutableSchema, query string, exts ...graphql.HandlerExtension) Response {
+	t.Helper()
+	return Do(t, NewServer(es, exts...), query, nil)
+}
@@ -0,0 +1,82 @@
+// Package introspection provides a gqlgen extension that toggles schema introspection, e.g. off in production.
+package introspection
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// errIntrospectionDisabled is the error of introspection queries when introspection is disabled.
+var errIntrospectionDisabled = errors.New("introspection is disabled")
+
+// Guard is a gqlgen extension that enables or disables introspection. Use it instead of extension.Introspection,
+// e.g. srv.Use(introspection.NewGuard(settings.Environment != "prod")).
+// When disabled, operations that query __schema or __type are rejected with the errorhandler.CodeForbidden code.
+// __typename is always allowed since clients use it to resolve union and interface types.
+type Guard struct {
+	enabled bool
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = Guard{}
+
+// NewGuard creates a new Guard extension that allows introspection if enabled is true.
+func NewGuard(enabled bool) Guard {
+	return Guard{enabled: enabled}
+}
+
+// ExtensionName returns the name of this extension.
+func (Guard) ExtensionName() string {
+	return "IntrospectionGuard"
+}
+
+// Validate validates the GraphQL schema.
+func (Guard) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext enables introspection for the operation, or rejects it if introspection is disabled
+// and the operation queries the schema.
+func (g Guard) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	if g.enabled {
+		opCtx.DisableIntrospection = false
+		return nil
+	}
+	opCtx.DisableIntrospection = true
+	if opCtx.Operation != nil && queriesSchema(opCtx.Doc, opCtx.Operation.SelectionSet) {
+		return errorhandler.NewForbiddenErrorWithMsg(ctx, errIntrospectionDisabled, "introspection is disabled")
+	}
+	return nil
+}
+
+// queriesSchema reports whether the root selection set selects __schema or __type, directly or through fragments.
+func queriesSchema(doc *ast.QueryDocument, selectionSet ast.SelectionSet) bool {
+	for _, selection := range selectionSet {
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if selection.Name == "__schema" || selection.Name == "__type" {
+				return true
+			}
+		case *ast.InlineFragment:
+			if queriesSchema(doc, selection.SelectionSet) {
+				return true
+			}
+		case *ast.FragmentSpread:
+			definition := selection.Definition
+			if definition == nil && doc != nil {
+				definition = doc.Fragments.ForName(selection.Name)
+			}
+			if definition != nil && queriesSchema(doc, definition.SelectionSet) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package introspection
+
+import (
+	"context"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/stretchr/testify/require"
+)
+
+// doQuery runs the query against a schema whose response reports whether introspection is enabled for the operation.
+func doQuery(t *testing.T, ext graphql.HandlerExtension, query string) gqltest.Response {
+	t.Helper()
+	es := gqltest.NewExecutableSchema(gqltest.Schema)
+	es.ExecFunc = func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			if graphql.GetOperationContext(ctx).DisableIntrospection {
+				return &graphql.Response{Data: []byte(`{"introspection":false}`)}
+			}
+			return &graphql.Response{Data: []byte(`{"introspection":true}`)}
+		}
+	}
+	return gqltest.Query(t, es, query, ext)
+}
+
+func TestGuardEnabled(t *testing.T) {
+	resp := doQuery(t, NewGuard(true), `{ __schema { queryType { name } } }`)
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `{"introspection":true}`, string(resp.Data))
+}
+
+func TestGuardDisabled(t *testing.T) {
+	queries := []string{
+		`{ __schema { queryType { name } } }`,
+		`{ __type(name: "Query") { name } }`,
+		`{ ... on Query { __schema { queryType { name } } } }`,
+		`{ ...schema } fragment schema on Query { __schema { queryType { name } } }`,
+	}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			resp := doQuery(t, NewGuard(false), query)
+			require.Len(t, resp.Errors, 1)
+			require.Equal(t, errorhandler.CodeForbidden, errorhandler.ErrCode(resp.Errors[0]))
+			require.Equal(t, "introspection is disabled", resp.Errors[0].Message)
+		})
+	}
+
+	resp := doQuery(t, NewGuard(false), `{ hello __typename }`)
+	require.Empty(t, resp.Errors)
+	require.JSONEq(t, `{"introspection":false}`, string(resp.Data))
+}
@@ -0,0 +1,43 @@
+// Package limits provides gqlgen extensions that reject GraphQL operations exceeding configured limits.
+package limits
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// ComplexityLimit is a gqlgen extension that rejects operations whose complexity exceeds a fixed limit.
+// Rejections carry the errorhandler.CodeBadUserInput code.
+// The complexity stats are still recorded so they can be read with extension.GetComplexityStats.
+type ComplexityLimit struct {
+	*extension.ComplexityLimit
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = ComplexityLimit{}
+
+// NewComplexityLimit creates a new ComplexityLimit extension with the given max complexity.
+func NewComplexityLimit(maxComplexity int) ComplexityLimit {
+	return ComplexityLimit{
+		ComplexityLimit: extension.FixedComplexityLimit(maxComplexity),
+	}
+}
+
+// MutateOperationContext calculates the complexity of the operation and rejects it if it exceeds the limit.
+func (c ComplexityLimit) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	gqlErr := c.ComplexityLimit.MutateOperationContext(ctx, opCtx)
+	if gqlErr == nil {
+		return nil
+	}
+	if gqlErr.Extensions == nil {
+		gqlErr.Extensions = map[string]interface{}{}
+	}
+	gqlErr.Extensions["code"] = errorhandler.CodeBadUserInput
+	return gqlErr
+}
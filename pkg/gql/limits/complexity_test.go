@@ -0,0 +1,32 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+const testSchema = `
+type Query { hello: String! world: String! vehicle: Vehicle }
+type Vehicle { id: ID! owner: User }
+type User { id: ID! vehicles: [Vehicle!]! }
+`
+
+// doQuery runs the query against a server using the given extension and returns the response errors.
+func doQuery(t *testing.T, ext graphql.HandlerExtension, query string) gqlerror.List {
+	t.Helper()
+	return gqltest.Query(t, gqltest.NewExecutableSchema(testSchema), query, ext).Errors
+}
+
+func TestComplexityLimit(t *testing.T) {
+	errs := doQuery(t, NewComplexityLimit(1), `{ hello }`)
+	require.Empty(t, errs)
+
+	errs = doQuery(t, NewComplexityLimit(1), `{ hello world }`)
+	require.Len(t, errs, 1)
+	require.Equal(t, errorhandler.CodeBadUserInput, errorhandler.ErrCode(errs[0]))
+}
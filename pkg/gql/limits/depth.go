@@ -0,0 +1,105 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/vektah/gqlparser/v2/ast"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// errDepthExceeded is the error of operations that are nested deeper than the limit.
+var errDepthExceeded = errors.New("operation depth exceeds the limit")
+
+// DepthLimit is a gqlgen extension that rejects operations whose selections are nested deeper than a fixed limit.
+// Rejections carry the errorhandler.CodeBadUserInput code.
+//
+// The depth is the number of nested fields, e.g. { vehicle { owner { id } } } has a depth of 3.
+// Fragments and inline fragments do not add to the depth, their fields are counted where they are spread.
+// The __typename meta field is not counted, as it has no selections. Introspection fields, such as __schema,
+// are counted like any other field so nested introspection queries cannot bypass the limit.
+type DepthLimit struct {
+	maxDepth int
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationContextMutator
+} = DepthLimit{}
+
+// NewDepthLimit creates a new DepthLimit extension with the given max depth.
+func NewDepthLimit(maxDepth int) DepthLimit {
+	return DepthLimit{maxDepth: maxDepth}
+}
+
+// ExtensionName returns the name of this extension.
+func (DepthLimit) ExtensionName() string {
+	return "DepthLimit"
+}
+
+// Validate validates the GraphQL schema.
+func (DepthLimit) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationContext calculates the depth of the operation and rejects it if it exceeds the limit.
+func (d DepthLimit) MutateOperationContext(ctx context.Context, opCtx *graphql.OperationContext) *gqlerror.Error {
+	if opCtx.Operation == nil {
+		return nil
+	}
+	walker := depthWalker{doc: opCtx.Doc, fragments: map[string]int{}}
+	depth := walker.selectionSetDepth(opCtx.Operation.SelectionSet)
+	if depth <= d.maxDepth {
+		return nil
+	}
+	msg := fmt.Sprintf("operation has depth %d, which exceeds the limit of %d", depth, d.maxDepth)
+	return errorhandler.NewErrorWithMsg(ctx, errDepthExceeded, msg, errorhandler.CodeBadUserInput)
+}
+
+// depthWalker calculates the depth of selection sets, caching the depth of named fragments.
+type depthWalker struct {
+	doc       *ast.QueryDocument
+	fragments map[string]int
+}
+
+func (w depthWalker) selectionSetDepth(selectionSet ast.SelectionSet) int {
+	depth := 0
+	for _, selection := range selectionSet {
+		var selectionDepth int
+		switch selection := selection.(type) {
+		case *ast.Field:
+			if selection.Name == "__typename" {
+				continue
+			}
+			selectionDepth = 1 + w.selectionSetDepth(selection.SelectionSet)
+		case *ast.InlineFragment:
+			selectionDepth = w.selectionSetDepth(selection.SelectionSet)
+		case *ast.FragmentSpread:
+			selectionDepth = w.fragmentDepth(selection)
+		}
+		depth = max(depth, selectionDepth)
+	}
+	return depth
+}
+
+// fragmentDepth returns the depth of a named fragment. Each fragment is walked once, however often it is spread.
+func (w depthWalker) fragmentDepth(spread *ast.FragmentSpread) int {
+	if depth, ok := w.fragments[spread.Name]; ok {
+		return depth
+	}
+	definition := spread.Definition
+	if definition == nil && w.doc != nil {
+		definition = w.doc.Fragments.ForName(spread.Name)
+	}
+	if definition == nil {
+		return 0
+	}
+	// fragment cycles are rejected by the validation, the entry guards against walking one forever
+	w.fragments[spread.Name] = 0
+	depth := w.selectionSetDepth(definition.SelectionSet)
+	w.fragments[spread.Name] = depth
+	return depth
+}
@@ -0,0 +1,45 @@
+package limits
+
+import (
+	"testing"
+
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDepthLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		rejected bool
+	}{
+		{name: "shallow", query: `{ hello vehicle { id owner { id } } }`},
+		{name: "deep", query: `{ vehicle { owner { vehicles { id } } } }`, rejected: true},
+		{
+			name:     "fragment",
+			query:    `{ vehicle { ...vehicleOwner } } fragment vehicleOwner on Vehicle { owner { vehicles { id } } }`,
+			rejected: true,
+		},
+		{
+			name:     "inline fragment",
+			query:    `{ vehicle { ... on Vehicle { owner { vehicles { id } } } } }`,
+			rejected: true,
+		},
+		{name: "shallow fragment", query: `{ vehicle { ...vehicleOwner } } fragment vehicleOwner on Vehicle { owner { id } }`},
+		{name: "typename", query: `{ __typename vehicle { owner { __typename id } } }`},
+		{name: "introspection", query: `{ __schema { queryType { name } } }`},
+		{name: "deep introspection", query: `{ __schema { types { fields { name } } } }`, rejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := doQuery(t, NewDepthLimit(3), tt.query)
+			if !tt.rejected {
+				require.Empty(t, errs)
+				return
+			}
+			require.Len(t, errs, 1)
+			require.Equal(t, errorhandler.CodeBadUserInput, errorhandler.ErrCode(errs[0]))
+			require.Equal(t, "operation has depth 4, which exceeds the limit of 3", errs[0].Message)
+		})
+	}
+}
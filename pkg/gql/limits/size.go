@@ -0,0 +1,73 @@
+package limits
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// errSizeExceeded is the error of operations whose query or variables are larger than the limit.
+var errSizeExceeded = errors.New("operation size exceeds the limit")
+
+// SizeLimitConfig configures the SizeLimit extension. A zero limit disables its check.
+type SizeLimitConfig struct {
+	// MaxQueryBytes is the max length of the query document in bytes.
+	MaxQueryBytes int
+	// MaxVariablesBytes is the max size of the JSON encoded variables in bytes.
+	MaxVariablesBytes int
+}
+
+// SizeLimit is a gqlgen extension that rejects operations whose query or variables are larger than a fixed limit,
+// e.g. a giant base64 blob in a variable. Rejections carry the errorhandler.CodeBadRequest code.
+//
+// The sizes are checked before the query is parsed and validated. Rejected operations are still counted by the
+// metrics.Tracer, with the anonymous operation name since the query is not parsed.
+// The request body has already been read and decoded at this point, so the body size should also be limited
+// by the HTTP server, e.g. with fibercommon.NewBodyLimitMiddleware.
+type SizeLimit struct {
+	cfg SizeLimitConfig
+}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationParameterMutator
+} = SizeLimit{}
+
+// NewSizeLimit creates a new SizeLimit extension with the given configuration.
+func NewSizeLimit(cfg SizeLimitConfig) SizeLimit {
+	return SizeLimit{cfg: cfg}
+}
+
+// ExtensionName returns the name of this extension.
+func (SizeLimit) ExtensionName() string {
+	return "SizeLimit"
+}
+
+// Validate validates the GraphQL schema.
+func (SizeLimit) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// MutateOperationParameters rejects the operation if its query or variables exceed the limits.
+func (s SizeLimit) MutateOperationParameters(ctx context.Context, params *graphql.RawParams) *gqlerror.Error {
+	if s.cfg.MaxQueryBytes > 0 && len(params.Query) > s.cfg.MaxQueryBytes {
+		msg := fmt.Sprintf("query exceeds the size limit of %d bytes", s.cfg.MaxQueryBytes)
+		return errorhandler.NewBadRequestErrorWithMsg(ctx, errSizeExceeded, msg)
+	}
+	if s.cfg.MaxVariablesBytes > 0 && len(params.Variables) > 0 {
+		variables, err := json.Marshal(params.Variables)
+		if err != nil {
+			return errorhandler.NewBadRequestErrorWithMsg(ctx, fmt.Errorf("failed to encode variables: %w", err), "invalid variables")
+		}
+		if len(variables) > s.cfg.MaxVariablesBytes {
+			msg := fmt.Sprintf("variables exceed the size limit of %d bytes", s.cfg.MaxVariablesBytes)
+			return errorhandler.NewBadRequestErrorWithMsg(ctx, errSizeExceeded, msg)
+		}
+	}
+	return nil
+}
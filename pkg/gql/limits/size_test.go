@@ -0,0 +1,66 @@
+package limits
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/gql/errorhandler"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/DIMO-Network/server-garage/pkg/gql/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/gqlerror"
+)
+
+// doQueryWithVariables runs the query with the variables against a server using the given extensions
+// and returns the response errors.
+func doQueryWithVariables(t *testing.T, exts []graphql.HandlerExtension, query string, variables map[string]any) gqlerror.List {
+	t.Helper()
+	srv := gqltest.NewServer(gqltest.NewExecutableSchema(`type Query { hello(blob: String): String! }`), exts...)
+	return gqltest.Do(t, srv, query, variables).Errors
+}
+
+func TestSizeLimit(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	exts := []graphql.HandlerExtension{
+		metrics.NewTracerWithConfig(metrics.TracerConfig{Registerer: reg}),
+		NewSizeLimit(SizeLimitConfig{MaxQueryBytes: 64, MaxVariablesBytes: 64}),
+	}
+	const query = `query GetHello($blob: String) { hello(blob: $blob) }`
+
+	errs := doQueryWithVariables(t, exts, query, map[string]any{"blob": "small"})
+	require.Empty(t, errs)
+
+	errs = doQueryWithVariables(t, exts, query, map[string]any{"blob": strings.Repeat("a", 100)})
+	require.Len(t, errs, 1)
+	require.Equal(t, errorhandler.CodeBadRequest, errorhandler.ErrCode(errs[0]))
+	require.Equal(t, "variables exceed the size limit of 64 bytes", errs[0].Message)
+
+	errs = doQueryWithVariables(t, exts, `{ hello `+strings.Repeat("world ", 20)+`}`, nil)
+	require.Len(t, errs, 1)
+	require.Equal(t, errorhandler.CodeBadRequest, errorhandler.ErrCode(errs[0]))
+	require.Equal(t, "query exceeds the size limit of 64 bytes", errs[0].Message)
+
+	// the rejected operations are counted by the tracer
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	var success, withErrors float64
+	for _, family := range families {
+		if family.GetName() != "graphql_request_total" {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			for _, label := range metric.GetLabel() {
+				if label.GetName() == "status" && label.GetValue() == "success" {
+					success += metric.GetCounter().GetValue()
+				}
+				if label.GetName() == "status" && label.GetValue() == "with_errors" {
+					withErrors += metric.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	require.Equal(t, 1.0, success)
+	require.Equal(t, 2.0, withErrors)
+}
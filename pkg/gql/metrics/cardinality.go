@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// DefaultMaxOperationNames is the default number of distinct operation names recorded in metric labels.
+	DefaultMaxOperationNames = 500
+	// overflowOperation is the operation name label used once the operation name limit is reached.
+	overflowOperation = "overflow"
+)
+
+// defaultOperationLimiter is the operation name limiter used by a zero value Tracer.
+var defaultOperationLimiter = newOperationLimiter(DefaultMaxOperationNames)
+
+// operationLimiter caps the number of distinct operation names used as metric labels,
+// which protects the metrics endpoint from unbounded label cardinality caused by clients sending many operation names.
+type operationLimiter struct {
+	mu         sync.Mutex
+	max        int
+	seen       map[string]struct{}
+	overflowed bool
+}
+
+func newOperationLimiter(maxNames int) *operationLimiter {
+	if maxNames <= 0 {
+		maxNames = DefaultMaxOperationNames
+	}
+	return &operationLimiter{
+		max:  maxNames,
+		seen: make(map[string]struct{}),
+	}
+}
+
+// label returns the operation name if it has been seen before or the limit has not been reached,
+// otherwise it returns the overflow label. A warning is logged the first time the limit is reached.
+func (l *operationLimiter) label(ctx context.Context, operationName string) string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.seen[operationName]; ok {
+		return operationName
+	}
+	if len(l.seen) < l.max {
+		l.seen[operationName] = struct{}{}
+		return operationName
+	}
+	if !l.overflowed {
+		l.overflowed = true
+		zerolog.Ctx(ctx).Warn().
+			Int("maxOperationNames", l.max).
+			Str("operationName", operationName).
+			Msg("graphql metrics operation name limit reached, recording new operations as overflow")
+	}
+	return overflowOperation
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// DefaultLatencyWindowSize is the default number of recent samples kept per operation by a LatencyWindow.
+const DefaultLatencyWindowSize = 1000
+
+// LatencyWindow keeps the most recent request durations per operation in memory to report latency percentiles
+// without a metrics backend. Memory is bounded by the window size per operation and by the operation name limit
+// of the Tracer that feeds it, see TracerConfig.MaxOperationNames.
+type LatencyWindow struct {
+	mu         sync.Mutex
+	size       int
+	operations map[string]*latencyRing
+}
+
+// latencyRing is a fixed size ring buffer of durations.
+type latencyRing struct {
+	samples []time.Duration
+	next    int
+}
+
+// LatencyPercentiles are the latency percentiles in milliseconds of the samples in a LatencyWindow.
+type LatencyPercentiles struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50Ms"`
+	P90   float64 `json:"p90Ms"`
+	P99   float64 `json:"p99Ms"`
+	Max   float64 `json:"maxMs"`
+}
+
+// NewLatencyWindow creates a LatencyWindow that keeps the last size samples of each operation.
+// If size is not positive, DefaultLatencyWindowSize is used.
+func NewLatencyWindow(size int) *LatencyWindow {
+	if size <= 0 {
+		size = DefaultLatencyWindowSize
+	}
+	return &LatencyWindow{
+		size:       size,
+		operations: make(map[string]*latencyRing),
+	}
+}
+
+// Observe records the duration of a request for the operation, replacing the oldest sample once the window is full.
+func (w *LatencyWindow) Observe(operationName string, d time.Duration) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ring, ok := w.operations[operationName]
+	if !ok {
+		ring = &latencyRing{samples: make([]time.Duration, 0, w.size)}
+		w.operations[operationName] = ring
+	}
+	if len(ring.samples) < w.size {
+		ring.samples = append(ring.samples, d)
+		return
+	}
+	ring.samples[ring.next] = d
+	ring.next = (ring.next + 1) % w.size
+}
+
+// Percentiles returns the latency percentiles of the samples in the window for each operation.
+func (w *LatencyWindow) Percentiles() map[string]LatencyPercentiles {
+	w.mu.Lock()
+	snapshot := make(map[string][]time.Duration, len(w.operations))
+	for name, ring := range w.operations {
+		snapshot[name] = slices.Clone(ring.samples)
+	}
+	w.mu.Unlock()
+
+	percentiles := make(map[string]LatencyPercentiles, len(snapshot))
+	for name, samples := range snapshot {
+		slices.Sort(samples)
+		percentiles[name] = LatencyPercentiles{
+			Count: len(samples),
+			P50:   milliseconds(percentile(samples, 50)),
+			P90:   milliseconds(percentile(samples, 90)),
+			P99:   milliseconds(percentile(samples, 99)),
+			Max:   milliseconds(samples[len(samples)-1]),
+		}
+	}
+	return percentiles
+}
+
+// Handler returns a handler that responds with the Percentiles as JSON keyed by operation name.
+// It is meant for the debug routes of the monitoring server, which are not exposed publicly, e.g.
+// monserver.WithDebugHandler("GET /debug/latency", window.Handler()).
+func (w *LatencyWindow) Handler() http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(rw).Encode(w.Percentiles())
+	})
+}
+
+// percentile returns the nearest rank percentile p of the sorted samples.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
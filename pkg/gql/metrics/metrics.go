@@ -2,11 +2,19 @@ package metrics
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/99designs/gqlgen/graphql"
 	"github.com/99designs/gqlgen/graphql/handler/extension"
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/rs/zerolog"
 )
 
 // ResponseSizeRange categorizes responses by size in bytes.
@@ -77,21 +85,296 @@ func GetFieldComplexityRange(count int) string {
 	}
 }
 
-var (
-	requestCounter = promauto.NewCounterVec(
-		prometheus.CounterOpts{
-			Name: "graphql_request_total",
-			Help: "Total number of requests on the graphql server, categorized by field count range and status.",
-		},
-		[]string{"response_size", "complexity", "status"},
-	)
+// getCustomResponseSizeRange returns the response size range for the given size using custom upper bounds in bytes.
+// Bounds must be sorted in ascending order.
+func getCustomResponseSizeRange(size int, bounds []int) string {
+	lower := 0
+	for _, bound := range bounds {
+		if size <= bound {
+			return formatBytes(lower) + "-" + formatBytes(bound)
+		}
+		lower = bound
+	}
+	return ">" + formatBytes(lower)
+}
+
+// getCustomFieldComplexityRange returns the field count range for the given count using custom upper bounds.
+// Bounds must be sorted in ascending order.
+func getCustomFieldComplexityRange(count int, bounds []int) string {
+	lower := 0
+	for _, bound := range bounds {
+		if count <= bound {
+			return strconv.Itoa(lower) + "-" + strconv.Itoa(bound)
+		}
+		lower = bound + 1
+	}
+	return strconv.Itoa(lower) + "+"
+}
+
+// formatBytes formats a byte count using the largest unit that divides it evenly.
+func formatBytes(n int) string {
+	switch {
+	case n == 0:
+		return "0"
+	case n%(1024*1024*1024) == 0:
+		return fmt.Sprintf("%dGB", n/(1024*1024*1024))
+	case n%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB", n/(1024*1024))
+	case n%1024 == 0:
+		return fmt.Sprintf("%dKB", n/1024)
+	default:
+		return fmt.Sprintf("%dB", n)
+	}
+}
+
+// anonymousOperation is the operation name label used for operations without a name.
+const anonymousOperation = "anonymous"
+
+// Values of the apq label of the request counter, which tells how a request used automatic persisted queries.
+const (
+	// APQNone is used for requests that did not use automatic persisted queries.
+	APQNone = "none"
+	// APQHit is used for requests that only sent the query hash and were served from the persisted query cache.
+	APQHit = "hit"
+	// APQMiss is used for requests that sent the full query with its hash, e.g. after the hash was not found in the cache.
+	APQMiss = "miss"
 )
 
+// requestCounterLabels are the labels of the request counter.
+var requestCounterLabels = []string{"response_size", "complexity", "status", "operation_name", "operation_type", "apq"}
+
+// inFlightCount is the number of requests in flight across all Tracers, see InFlightRequests.
+var inFlightCount atomic.Int64
+
+// defaultRequestCounter is the request counter used by a zero value Tracer.
+// Like the other metrics of a zero value Tracer, it is registered with the default registerer on first use
+// instead of at package initialization.
+var defaultRequestCounter = sync.OnceValue(func() *prometheus.CounterVec {
+	return registerCollector(prometheus.DefaultRegisterer, prometheus.NewCounterVec(requestCounterOpts(TracerConfig{}), requestCounterLabels))
+})
+
+// defaultInFlightGauge is the in flight requests gauge used by a zero value Tracer.
+var defaultInFlightGauge = sync.OnceValue(func() prometheus.Gauge {
+	return registerCollector(prometheus.DefaultRegisterer, prometheus.NewGauge(inFlightGaugeOpts(TracerConfig{})))
+})
+
+// requestCounterOpts returns the options of the request counter for the given configuration.
+func requestCounterOpts(cfg TracerConfig) prometheus.CounterOpts {
+	return prometheus.CounterOpts{
+		Namespace: cfg.Namespace,
+		Subsystem: cfg.Subsystem,
+		Name:      "graphql_request_total",
+		Help:      "Total number of requests on the graphql server, categorized by field count range, status and operation.",
+	}
+}
+
+// inFlightGaugeOpts returns the options of the in flight requests gauge for the given configuration.
+func inFlightGaugeOpts(cfg TracerConfig) prometheus.GaugeOpts {
+	return prometheus.GaugeOpts{
+		Namespace: cfg.Namespace,
+		Subsystem: cfg.Subsystem,
+		Name:      "graphql_requests_in_flight",
+		Help:      "Number of requests currently being processed by the graphql server.",
+	}
+}
+
+// InFlightRequests returns the number of GraphQL requests currently being processed by Tracers.
+func InFlightRequests() int64 {
+	return inFlightCount.Load()
+}
+
+// defaultDurationHistogram is the duration histogram used by a zero value Tracer.
+// It is registered on first use so a Tracer created with NewTracer can register the metric with custom buckets instead.
+var defaultDurationHistogram = sync.OnceValue(func() *prometheus.HistogramVec {
+	return newDurationHistogram(prometheus.DefaultRegisterer, durationHistogramOpts(TracerConfig{}))
+})
+
+// defaultTTFBHistogram is the time to first byte histogram used by a zero value Tracer.
+var defaultTTFBHistogram = sync.OnceValue(func() *prometheus.HistogramVec {
+	return newDurationHistogram(prometheus.DefaultRegisterer, ttfbHistogramOpts(TracerConfig{}))
+})
+
+// durationHistogramOpts returns the options of the request duration histogram for the given configuration.
+func durationHistogramOpts(cfg TracerConfig) prometheus.HistogramOpts {
+	opts := prometheus.HistogramOpts{
+		Namespace: cfg.Namespace,
+		Subsystem: cfg.Subsystem,
+		Name:      "graphql_request_duration_seconds",
+		Help:      "Duration of requests on the graphql server in seconds, categorized by operation and status.",
+		Buckets:   cfg.DurationBuckets,
+	}
+	if cfg.NativeHistogram {
+		// classic buckets are only added to native histograms when explicitly configured
+		opts.NativeHistogramBucketFactor = 1.1
+		opts.NativeHistogramMaxBucketNumber = 100
+		opts.NativeHistogramMinResetDuration = time.Hour
+	} else if len(opts.Buckets) == 0 {
+		opts.Buckets = prometheus.DefBuckets
+	}
+	return opts
+}
+
+// ttfbHistogramOpts returns the options of the time to first byte histogram for the given configuration.
+// It uses the same buckets as the request duration histogram so the two can be compared.
+func ttfbHistogramOpts(cfg TracerConfig) prometheus.HistogramOpts {
+	opts := durationHistogramOpts(cfg)
+	opts.Name = "graphql_time_to_first_byte_seconds"
+	opts.Help = "Time until the first response of a request on the graphql server is ready in seconds, categorized by operation and status."
+	return opts
+}
+
+// newDurationHistogram creates and registers the request duration histogram with the given options.
+// If the histogram is already registered the existing one is returned, and a warning is logged with the
+// default context logger if it was registered with other buckets, which are then used instead.
+func newDurationHistogram(reg prometheus.Registerer, opts prometheus.HistogramOpts) *prometheus.HistogramVec {
+	histogram := registerCollector(reg, prometheus.NewHistogramVec(opts, []string{"operation_name", "status"}))
+	checkHistogramOpts(reg, opts)
+	return histogram
+}
+
+// histogramKey identifies a histogram registered with a registerer.
+type histogramKey struct {
+	reg  prometheus.Registerer
+	name string
+}
+
+// registeredHistograms holds the options of the histograms registered by newDurationHistogram.
+var registeredHistograms = struct {
+	sync.Mutex
+	opts map[histogramKey]prometheus.HistogramOpts
+}{opts: map[histogramKey]prometheus.HistogramOpts{}}
+
+// checkHistogramOpts records the options of the first histogram registered with the name and logs a warning
+// if the histogram was already registered with other buckets.
+func checkHistogramOpts(reg prometheus.Registerer, opts prometheus.HistogramOpts) {
+	if !reflect.TypeOf(reg).Comparable() {
+		return
+	}
+	key := histogramKey{reg: reg, name: prometheus.BuildFQName(opts.Namespace, opts.Subsystem, opts.Name)}
+	registeredHistograms.Lock()
+	registered, ok := registeredHistograms.opts[key]
+	if !ok {
+		registeredHistograms.opts[key] = opts
+	}
+	registeredHistograms.Unlock()
+	if !ok || sameBuckets(registered, opts) {
+		return
+	}
+	zerolog.Ctx(context.Background()).Warn().
+		Str("metric", key.name).
+		Floats64("buckets", opts.Buckets).
+		Bool("nativeHistogram", opts.NativeHistogramBucketFactor > 1).
+		Floats64("registeredBuckets", registered.Buckets).
+		Bool("registeredNativeHistogram", registered.NativeHistogramBucketFactor > 1).
+		Msg("histogram is already registered with other buckets, the configured buckets are ignored")
+}
+
+// sameBuckets reports whether the classic and native buckets of the histogram options are the same.
+func sameBuckets(a, b prometheus.HistogramOpts) bool {
+	return slices.Equal(a.Buckets, b.Buckets) &&
+		a.NativeHistogramBucketFactor == b.NativeHistogramBucketFactor &&
+		a.NativeHistogramMaxBucketNumber == b.NativeHistogramMaxBucketNumber &&
+		a.NativeHistogramMinResetDuration == b.NativeHistogramMinResetDuration
+}
+
+// registerCollector registers the collector with the registerer.
+// If an equal collector is already registered, the existing collector is returned instead.
+func registerCollector[T prometheus.Collector](reg prometheus.Registerer, collector T) T {
+	if err := reg.Register(collector); err != nil {
+		var alreadyRegistered prometheus.AlreadyRegisteredError
+		if errors.As(err, &alreadyRegistered) {
+			if existing, ok := alreadyRegistered.ExistingCollector.(T); ok {
+				return existing
+			}
+		}
+		panic(err)
+	}
+	return collector
+}
+
 // Tracer provides a GraphQL middleware for collecting Prometheus metrics.
-type Tracer struct{}
+// The zero value is ready to use and records durations with the default Prometheus buckets
+// and the default response size and complexity ranges. Its metrics are registered with the default registerer
+// on first use, use NewTracerWithConfig to register them with another registerer.
+type Tracer struct {
+	requestCounter     *prometheus.CounterVec
+	inFlightGauge      prometheus.Gauge
+	durationHistogram  *prometheus.HistogramVec
+	ttfbHistogram      *prometheus.HistogramVec
+	responseSizeBounds []int
+	complexityBounds   []int
+	operationLimiter   *operationLimiter
+	latencyWindow      *LatencyWindow
+}
+
+// TracerConfig configures a Tracer created with NewTracerWithConfig.
+type TracerConfig struct {
+	// DurationBuckets are the histogram buckets in seconds for request durations.
+	// Defaults to prometheus.DefBuckets for classic histograms and no classic buckets for native histograms.
+	DurationBuckets []float64
+	// NativeHistogram records request durations as a Prometheus native histogram with sparse buckets.
+	// Classic histograms are used by default for compatibility with scrapers that do not support native histograms.
+	NativeHistogram bool
+	// ResponseSizeBounds are the upper bounds in bytes of the response size label ranges.
+	// Defaults to the ResponseSizeRange ranges.
+	ResponseSizeBounds []int
+	// ComplexityBounds are the upper bounds of the complexity label ranges.
+	// Defaults to the FieldCountRange ranges.
+	ComplexityBounds []int
+	// MaxOperationNames caps the number of distinct operation names recorded in metric labels.
+	// Operations seen after the cap is reached are recorded as "overflow". Defaults to DefaultMaxOperationNames.
+	MaxOperationNames int
+	// Namespace and Subsystem are prepended to the names of the metrics, e.g. with the namespace "dimo"
+	// the request counter is named dimo_graphql_request_total. Both are empty by default.
+	Namespace string
+	Subsystem string
+	// LatencyWindow, when set, receives the duration of every request to report recent latency percentiles
+	// per operation. It is not set by default.
+	LatencyWindow *LatencyWindow
+	// Registerer registers the metrics of the Tracer. Tracers with the same registerer and metric options share
+	// their metrics. Use a separate prometheus.Registry to isolate the metrics, e.g. in tests.
+	// Defaults to prometheus.DefaultRegisterer.
+	Registerer prometheus.Registerer
+}
+
+// NewTracer creates a new Tracer that records request durations with the given histogram buckets.
+// Only the buckets of the first registered duration histogram are used, see NewTracerWithConfig.
+func NewTracer(buckets []float64) Tracer {
+	return NewTracerWithConfig(TracerConfig{DurationBuckets: buckets})
+}
+
+// NewTracerWithConfig creates a new Tracer with the given configuration and registers its metrics.
+// Only the buckets of the first registered duration histogram of a registerer are used. A warning is logged
+// with the default context logger when the configured buckets or native histogram option differ from them.
+func NewTracerWithConfig(cfg TracerConfig) Tracer {
+	reg := cfg.Registerer
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	return Tracer{
+		requestCounter:     registerCollector(reg, prometheus.NewCounterVec(requestCounterOpts(cfg), requestCounterLabels)),
+		inFlightGauge:      registerCollector(reg, prometheus.NewGauge(inFlightGaugeOpts(cfg))),
+		durationHistogram:  newDurationHistogram(reg, durationHistogramOpts(cfg)),
+		ttfbHistogram:      newDurationHistogram(reg, ttfbHistogramOpts(cfg)),
+		responseSizeBounds: sortedBounds(cfg.ResponseSizeBounds),
+		complexityBounds:   sortedBounds(cfg.ComplexityBounds),
+		operationLimiter:   newOperationLimiter(cfg.MaxOperationNames),
+		latencyWindow:      cfg.LatencyWindow,
+	}
+}
+
+func sortedBounds(bounds []int) []int {
+	if len(bounds) == 0 {
+		return nil
+	}
+	sorted := slices.Clone(bounds)
+	slices.Sort(sorted)
+	return slices.Compact(sorted)
+}
 
 var _ interface {
 	graphql.HandlerExtension
+	graphql.OperationInterceptor
 	graphql.ResponseInterceptor
 } = Tracer{}
 
@@ -105,31 +388,143 @@ func (a Tracer) Validate(schema graphql.ExecutableSchema) error {
 	return nil
 }
 
+// InterceptOperation intercepts GraphQL operations to record the time to first byte,
+// the time from the start of the operation until its first response is ready to be written.
+// For deferred and streamed operations this distinguishes slow to start from slow to stream responses.
+func (a Tracer) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	start := time.Now()
+	if graphql.HasOperationContext(ctx) {
+		if opStart := graphql.GetOperationContext(ctx).Stats.OperationStart; !opStart.IsZero() {
+			start = opStart
+		}
+	}
+	responseHandler := next(ctx)
+	var firstResponse sync.Once
+	return func(ctx context.Context) *graphql.Response {
+		response := responseHandler(ctx)
+		firstResponse.Do(func() {
+			ttfb := time.Since(start)
+			operationName, _ := getOperationLabels(ctx)
+			operationName = a.limiter().label(ctx, operationName)
+			ttfbHistogram := a.ttfbHistogram
+			if ttfbHistogram == nil {
+				ttfbHistogram = defaultTTFBHistogram()
+			}
+			ttfbHistogram.WithLabelValues(operationName, responseStatus(response)).Observe(ttfb.Seconds())
+		})
+		return response
+	}
+}
+
 // InterceptResponse intercepts GraphQL responses to record metrics.
 func (a Tracer) InterceptResponse(
 	ctx context.Context,
 	next graphql.ResponseHandler,
 ) *graphql.Response {
+	gauge := a.inFlightGauge
+	if gauge == nil {
+		gauge = defaultInFlightGauge()
+	}
+	gauge.Inc()
+	inFlightCount.Add(1)
+	defer func() {
+		inFlightCount.Add(-1)
+		gauge.Dec()
+	}()
+	start := time.Now()
 	response := next(ctx)
+	duration := time.Since(start)
 	sizeStat := "unknown"
 	complexityStat := "unknown"
-	statusStat := "success"
+	statusStat := responseStatus(response)
 
 	// Calculate response size and increment appropriate counter
 	if response != nil {
-		sizeStat = GetResponseSizeRange(len(response.Data))
-
-		if len(response.Errors) > 0 {
-			statusStat = "with_errors"
+		if a.responseSizeBounds != nil {
+			sizeStat = getCustomResponseSizeRange(len(response.Data), a.responseSizeBounds)
+		} else {
+			sizeStat = GetResponseSizeRange(len(response.Data))
 		}
 	}
 
 	complexity := extension.GetComplexityStats(ctx)
 	if complexity != nil {
-		complexityStat = GetFieldComplexityRange(complexity.Complexity)
+		if a.complexityBounds != nil {
+			complexityStat = getCustomFieldComplexityRange(complexity.Complexity, a.complexityBounds)
+		} else {
+			complexityStat = GetFieldComplexityRange(complexity.Complexity)
+		}
+	}
+
+	operationName, operationType := getOperationLabels(ctx)
+	operationName = a.limiter().label(ctx, operationName)
+
+	counter := a.requestCounter
+	if counter == nil {
+		counter = defaultRequestCounter()
 	}
+	counter.WithLabelValues(sizeStat, complexityStat, statusStat, operationName, operationType, apqLabel(ctx)).Inc()
 
-	requestCounter.WithLabelValues(sizeStat, complexityStat, statusStat).Inc()
+	durationHistogram := a.durationHistogram
+	if durationHistogram == nil {
+		durationHistogram = defaultDurationHistogram()
+	}
+	durationHistogram.WithLabelValues(operationName, statusStat).Observe(duration.Seconds())
+	if a.latencyWindow != nil {
+		a.latencyWindow.Observe(operationName, duration)
+	}
 
 	return response
 }
+
+// limiter returns the operation name limiter of the Tracer, or the default one for a zero value Tracer.
+func (a Tracer) limiter() *operationLimiter {
+	if a.operationLimiter == nil {
+		return defaultOperationLimiter
+	}
+	return a.operationLimiter
+}
+
+// responseStatus returns the status label of the response.
+func responseStatus(response *graphql.Response) string {
+	if response != nil && len(response.Errors) > 0 {
+		return "with_errors"
+	}
+	return "success"
+}
+
+// apqLabel returns the apq label of the request, derived from the stats recorded by the
+// extension.AutomaticPersistedQuery extension in the operation context.
+func apqLabel(ctx context.Context) string {
+	if !graphql.HasOperationContext(ctx) {
+		return APQNone
+	}
+	stats := extension.GetApqStats(ctx)
+	switch {
+	case stats == nil:
+		return APQNone
+	case stats.SentQuery:
+		return APQMiss
+	default:
+		return APQHit
+	}
+}
+
+// getOperationLabels returns the operation name and type of the request.
+// Anonymous operations are labeled as "anonymous" to keep the label cardinality bounded.
+func getOperationLabels(ctx context.Context) (string, string) {
+	operationName := anonymousOperation
+	operationType := "unknown"
+	if !graphql.HasOperationContext(ctx) {
+		return operationName, operationType
+	}
+	opCtx := graphql.GetOperationContext(ctx)
+	if opCtx.Operation == nil {
+		return operationName, operationType
+	}
+	if opCtx.Operation.Name != "" {
+		operationName = opCtx.Operation.Name
+	}
+	operationType = string(opCtx.Operation.Operation)
+	return operationName, operationType
+}
@@ -0,0 +1,403 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/DIMO-Network/server-garage/pkg/monserver"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"github.com/vektah/gqlparser/v2/ast"
+)
+
+const testSchema = `type Query { hello: String! } type Mutation { setHello(value: String!): String! }`
+
+// doQuery runs the query against a server using the given tracer.
+func doQuery(t *testing.T, tracer graphql.HandlerExtension, query string) {
+	t.Helper()
+	resp := gqltest.Query(t, gqltest.NewExecutableSchema(testSchema), query, tracer)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestTracerOperationLabels(t *testing.T) {
+	tests := []struct {
+		name          string
+		query         string
+		operationName string
+		operationType string
+	}{
+		{
+			name:          "named query",
+			query:         `query GetHello { hello }`,
+			operationName: "GetHello",
+			operationType: "query",
+		},
+		{
+			name:          "anonymous query",
+			query:         `{ hello }`,
+			operationName: "anonymous",
+			operationType: "query",
+		},
+		{
+			name:          "named mutation",
+			query:         `mutation SetHello { setHello(value: "hi") }`,
+			operationName: "SetHello",
+			operationType: "mutation",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter := defaultRequestCounter().WithLabelValues(string(ResponseSizeTiny), "unknown", "success", tt.operationName, tt.operationType, APQNone)
+			before := testutil.ToFloat64(counter)
+			doQuery(t, Tracer{}, tt.query)
+			require.Equal(t, before+1, testutil.ToFloat64(counter))
+		})
+	}
+}
+
+func TestTracerDurationHistogram(t *testing.T) {
+	tracer := NewTracer([]float64{0.01, 0.1, 1})
+	// Only one duration histogram can be registered, so the zero value Tracer shares it.
+	require.Same(t, tracer.durationHistogram, defaultDurationHistogram())
+
+	before := testutil.CollectAndCount(tracer.durationHistogram)
+	doQuery(t, tracer, `query GetDuration { hello }`)
+	require.Equal(t, before+1, testutil.CollectAndCount(tracer.durationHistogram))
+}
+
+func TestCustomRanges(t *testing.T) {
+	sizeBounds := []int{1024, 4 * 1024, 10 * 1024}
+	require.Equal(t, "0-1KB", getCustomResponseSizeRange(0, sizeBounds))
+	require.Equal(t, "1KB-4KB", getCustomResponseSizeRange(2000, sizeBounds))
+	require.Equal(t, "4KB-10KB", getCustomResponseSizeRange(10*1024, sizeBounds))
+	require.Equal(t, ">10KB", getCustomResponseSizeRange(10*1024+1, sizeBounds))
+
+	complexityBounds := []int{2, 5}
+	require.Equal(t, "0-2", getCustomFieldComplexityRange(1, complexityBounds))
+	require.Equal(t, "3-5", getCustomFieldComplexityRange(5, complexityBounds))
+	require.Equal(t, "6+", getCustomFieldComplexityRange(6, complexityBounds))
+}
+
+func TestTracerCustomResponseSizeRange(t *testing.T) {
+	tracer := NewTracerWithConfig(TracerConfig{ResponseSizeBounds: []int{10, 1024}})
+	counter := defaultRequestCounter().WithLabelValues("10B-1KB", "unknown", "success", "GetCustomSize", "query", APQNone)
+	before := testutil.ToFloat64(counter)
+	doQuery(t, tracer, `query GetCustomSize { hello }`)
+	require.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func TestNativeHistogramOpts(t *testing.T) {
+	classic := durationHistogramOpts(TracerConfig{})
+	require.Equal(t, prometheus.DefBuckets, classic.Buckets)
+	require.Zero(t, classic.NativeHistogramBucketFactor)
+
+	native := durationHistogramOpts(TracerConfig{NativeHistogram: true})
+	require.Empty(t, native.Buckets)
+	require.Greater(t, native.NativeHistogramBucketFactor, 1.0)
+
+	// The native histogram variant can be constructed and observed.
+	histogram := prometheus.NewHistogramVec(native, []string{"operation_name", "status"})
+	histogram.WithLabelValues("GetNative", "success").Observe(0.25)
+	require.Equal(t, 1, testutil.CollectAndCount(histogram))
+
+	// The registered histogram of a tracer is native, without classic buckets.
+	reg := prometheus.NewRegistry()
+	tracer := NewTracerWithConfig(TracerConfig{NativeHistogram: true, Registerer: reg})
+	doQuery(t, tracer, `query GetNative { hello }`)
+	registered := gatherHistogram(t, reg, "graphql_request_duration_seconds")
+	require.NotNil(t, registered.Schema, "native histograms have a schema")
+	require.Empty(t, registered.GetBucket())
+}
+
+func TestDurationHistogramConflict(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	prevLogger := zerolog.DefaultContextLogger
+	zerolog.DefaultContextLogger = &logger
+	t.Cleanup(func() { zerolog.DefaultContextLogger = prevLogger })
+
+	reg := prometheus.NewRegistry()
+	tracer := NewTracerWithConfig(TracerConfig{DurationBuckets: []float64{0.1, 1}, Registerer: reg})
+	require.Same(t, tracer.durationHistogram, NewTracerWithConfig(TracerConfig{DurationBuckets: []float64{0.1, 1}, Registerer: reg}).durationHistogram)
+	require.Empty(t, buf.String())
+
+	// A native histogram is not registered over the classic one, the classic buckets keep being used.
+	native := NewTracerWithConfig(TracerConfig{NativeHistogram: true, Registerer: reg})
+	require.Same(t, tracer.durationHistogram, native.durationHistogram)
+	require.Contains(t, buf.String(), `"level":"warn"`)
+	require.Contains(t, buf.String(), `"metric":"graphql_request_duration_seconds"`)
+	require.Contains(t, buf.String(), `"registeredBuckets":[0.1,1]`)
+
+	doQuery(t, native, `query GetConflict { hello }`)
+	histogram := gatherHistogram(t, reg, "graphql_request_duration_seconds")
+	require.Nil(t, histogram.Schema)
+	require.Len(t, histogram.GetBucket(), 2)
+}
+
+// gatherHistogram returns the first histogram of the metric family with the name gathered from the registry.
+func gatherHistogram(t *testing.T, reg *prometheus.Registry, name string) *dto.Histogram {
+	t.Helper()
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	for _, family := range families {
+		if family.GetName() == name && len(family.GetMetric()) > 0 {
+			return family.GetMetric()[0].GetHistogram()
+		}
+	}
+	require.Failf(t, "metric not found", "no %s metric was gathered", name)
+	return nil
+}
+
+func TestOperationLimiterOverflow(t *testing.T) {
+	var buf bytes.Buffer
+	ctx := zerolog.New(&buf).WithContext(context.Background())
+	limiter := newOperationLimiter(2)
+
+	require.Equal(t, "GetA", limiter.label(ctx, "GetA"))
+	require.Equal(t, "GetB", limiter.label(ctx, "GetB"))
+	require.Equal(t, overflowOperation, limiter.label(ctx, "GetC"))
+	require.Equal(t, overflowOperation, limiter.label(ctx, "GetD"))
+	// Operations seen before the cap keep their name.
+	require.Equal(t, "GetA", limiter.label(ctx, "GetA"))
+
+	require.Equal(t, 1, strings.Count(buf.String(), "operation name limit reached"))
+}
+
+func TestTracerOperationOverflow(t *testing.T) {
+	tracer := NewTracerWithConfig(TracerConfig{MaxOperationNames: 1})
+	counter := defaultRequestCounter().WithLabelValues(string(ResponseSizeTiny), "unknown", "success", overflowOperation, "query", APQNone)
+	before := testutil.ToFloat64(counter)
+	doQuery(t, tracer, `query GetFirst { hello }`)
+	doQuery(t, tracer, `query GetSecond { hello }`)
+	require.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func TestInFlightRequestsStats(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	es := gqltest.NewExecutableSchema(testSchema)
+	es.ExecFunc = func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			close(started)
+			<-release
+			return &graphql.Response{Data: []byte(`{"hello":"world"}`)}
+		}
+	}
+	srv := gqltest.NewServer(es, Tracer{})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":"{ hello }"}`))
+		req.Header.Set("Content-Type", "application/json")
+		srv.ServeHTTP(httptest.NewRecorder(), req)
+	}()
+	<-started
+
+	mux := monserver.NewMonitoringServer(nil, true, monserver.WithInFlightCounter("graphql", InFlightRequests))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/stats", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"inFlightRequests":{"graphql":1}}`, w.Body.String())
+
+	close(release)
+	<-done
+	require.Equal(t, int64(0), InFlightRequests())
+}
+
+func TestInFlightRequestsPanic(t *testing.T) {
+	gauge := prometheus.NewGauge(inFlightGaugeOpts(TracerConfig{}))
+	tracer := Tracer{inFlightGauge: gauge}
+	before := InFlightRequests()
+
+	require.Panics(t, func() {
+		tracer.InterceptResponse(context.Background(), func(ctx context.Context) *graphql.Response {
+			panic("resolver panic")
+		})
+	})
+	require.Equal(t, before, InFlightRequests())
+	require.Zero(t, testutil.ToFloat64(gauge))
+}
+
+func TestTracerTimeToFirstByte(t *testing.T) {
+	opts := ttfbHistogramOpts(TracerConfig{})
+	tracer := Tracer{ttfbHistogram: prometheus.NewHistogramVec(opts, []string{"operation_name", "status"})}
+
+	ctx := graphql.WithOperationContext(context.Background(), &graphql.OperationContext{
+		Operation: &ast.OperationDefinition{Name: "GetStream", Operation: ast.Query},
+		Stats:     graphql.Stats{OperationStart: time.Now()},
+	})
+	chunks := 0
+	responseHandler := tracer.InterceptOperation(ctx, func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			chunks++
+			if chunks == 1 {
+				time.Sleep(20 * time.Millisecond)
+				hasNext := true
+				return &graphql.Response{Data: []byte(`{"hello":"world"}`), HasNext: &hasNext}
+			}
+			time.Sleep(200 * time.Millisecond)
+			hasNext := false
+			return &graphql.Response{Data: []byte(`{"hello":"again"}`), HasNext: &hasNext}
+		}
+	})
+	responseHandler(ctx)
+	responseHandler(ctx)
+
+	var metric dto.Metric
+	observer, err := tracer.ttfbHistogram.GetMetricWithLabelValues("GetStream", "success")
+	require.NoError(t, err)
+	require.NoError(t, observer.(prometheus.Metric).Write(&metric))
+	require.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	require.GreaterOrEqual(t, metric.GetHistogram().GetSampleSum(), 0.02)
+	require.Less(t, metric.GetHistogram().GetSampleSum(), 0.2)
+}
+
+func TestTracerNamespace(t *testing.T) {
+	tracer := NewTracerWithConfig(TracerConfig{Namespace: "dimo", Subsystem: "test"})
+	doQuery(t, tracer, `query GetNamespaced { hello }`)
+
+	count, err := testutil.GatherAndCount(prometheus.DefaultGatherer, "dimo_test_graphql_request_total")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+	count, err = testutil.GatherAndCount(prometheus.DefaultGatherer, "dimo_test_graphql_request_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// The default name is kept without a namespace.
+	counter := defaultRequestCounter().WithLabelValues(string(ResponseSizeTiny), "unknown", "success", "GetDefault", "query", APQNone)
+	before := testutil.ToFloat64(counter)
+	doQuery(t, NewTracerWithConfig(TracerConfig{}), `query GetDefault { hello }`)
+	require.Equal(t, before+1, testutil.ToFloat64(counter))
+}
+
+func TestTracerRegisterer(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	tracer := NewTracerWithConfig(TracerConfig{Namespace: "svc", Registerer: reg})
+	doQuery(t, tracer, `query GetRegistered { hello }`)
+
+	count, err := testutil.GatherAndCount(reg, "svc_graphql_request_total", "svc_graphql_request_duration_seconds")
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+	count, err = testutil.GatherAndCount(prometheus.DefaultGatherer, "svc_graphql_request_total")
+	require.NoError(t, err)
+	require.Zero(t, count, "metrics of a custom registerer must not be registered with the default one")
+}
+
+func TestTracersWithSeparateRegistries(t *testing.T) {
+	regA := prometheus.NewRegistry()
+	regB := prometheus.NewRegistry()
+	require.NotPanics(t, func() {
+		tracerA := NewTracerWithConfig(TracerConfig{Registerer: regA})
+		tracerB := NewTracerWithConfig(TracerConfig{Registerer: regB})
+		// Registering the same metrics again with a registry returns the existing ones.
+		require.Same(t, tracerA.durationHistogram, NewTracerWithConfig(TracerConfig{Registerer: regA}).durationHistogram)
+
+		doQuery(t, tracerA, `query GetA { hello }`)
+		doQuery(t, tracerB, `query GetB { hello }`)
+		doQuery(t, tracerB, `query GetB { hello }`)
+	})
+
+	countOf := func(reg *prometheus.Registry, operationName string) float64 {
+		families, err := reg.Gather()
+		require.NoError(t, err)
+		var total float64
+		for _, family := range families {
+			if family.GetName() != "graphql_request_total" {
+				continue
+			}
+			for _, metric := range family.GetMetric() {
+				for _, label := range metric.GetLabel() {
+					if label.GetName() == "operation_name" && label.GetValue() == operationName {
+						total += metric.GetCounter().GetValue()
+					}
+				}
+			}
+		}
+		return total
+	}
+	require.Equal(t, 1.0, countOf(regA, "GetA"))
+	require.Zero(t, countOf(regA, "GetB"))
+	require.Equal(t, 2.0, countOf(regB, "GetB"))
+	require.Zero(t, countOf(regB, "GetA"))
+}
+
+// mapCache is a graphql.Cache for the persisted queries of a test.
+type mapCache map[string]string
+
+func (c mapCache) Get(_ context.Context, key string) (string, bool) {
+	value, ok := c[key]
+	return value, ok
+}
+
+func (c mapCache) Add(_ context.Context, key string, value string) {
+	c[key] = value
+}
+
+func TestAPQLabel(t *testing.T) {
+	apq := extension.AutomaticPersistedQuery{Cache: mapCache{}}
+	query := "query GetPersisted { hello }"
+	sum := sha256.Sum256([]byte(query))
+	persistedQuery := map[string]any{"version": 1, "sha256Hash": hex.EncodeToString(sum[:])}
+
+	// apqContext returns a synthetic operation context after the APQ extension processed the request.
+	apqContext := func(params *graphql.RawParams) context.Context {
+		ctx := graphql.WithOperationContext(context.Background(), &graphql.OperationContext{})
+		require.Nil(t, apq.MutateOperationParameters(ctx, params))
+		return ctx
+	}
+
+	require.Equal(t, APQNone, apqLabel(context.Background()))
+	require.Equal(t, APQNone, apqLabel(apqContext(&graphql.RawParams{Query: query})))
+	// The first request sends the full query to register it.
+	require.Equal(t, APQMiss, apqLabel(apqContext(&graphql.RawParams{
+		Query:      query,
+		Extensions: map[string]any{"persistedQuery": persistedQuery},
+	})))
+	// Later requests only send the hash.
+	require.Equal(t, APQHit, apqLabel(apqContext(&graphql.RawParams{
+		Extensions: map[string]any{"persistedQuery": persistedQuery},
+	})))
+}
+
+func TestLatencyWindowPercentiles(t *testing.T) {
+	window := NewLatencyWindow(100)
+	// Older samples are replaced once the window is full.
+	for range 100 {
+		window.Observe("GetOld", time.Hour)
+	}
+	for i := 1; i <= 100; i++ {
+		window.Observe("GetOld", time.Duration(i)*time.Millisecond)
+	}
+	require.Equal(t, LatencyPercentiles{Count: 100, P50: 50, P90: 90, P99: 99, Max: 100}, window.Percentiles()["GetOld"])
+
+	tracer := NewTracerWithConfig(TracerConfig{LatencyWindow: window})
+	for range 3 {
+		doQuery(t, tracer, `query GetLatency { hello }`)
+	}
+
+	mux := monserver.NewMonitoringServer(nil, true, monserver.WithDebugHandler("GET /debug/latency", window.Handler()))
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/debug/latency", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var resp map[string]LatencyPercentiles
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	require.Equal(t, 3, resp["GetLatency"].Count)
+	require.Greater(t, resp["GetLatency"].Max, 0.0)
+	require.LessOrEqual(t, resp["GetLatency"].P50, resp["GetLatency"].Max)
+}
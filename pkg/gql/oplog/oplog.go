@@ -0,0 +1,85 @@
+// Package oplog surfaces the GraphQL operation name in the logs of a Fiber served gqlgen handler.
+package oplog
+
+import (
+	"context"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+)
+
+// operationKey is the key used to store the operation info in the request locals.
+// Fiber locals are exposed as context values to net/http handlers run through the fiber adaptor,
+// which lets the gqlgen extension write to the same value the Fiber middleware reads.
+type operationKey struct{}
+
+type operationInfo struct {
+	name string
+}
+
+// Middleware is a Fiber middleware that records the GraphQL operation name set by the Extension and adds it to the
+// context logger of the request as gqlOperation once the handler returns. It does not log itself, the operation name
+// is logged by the request logs written after the handler, such as the line of fibercommon.AccessLogMiddleware.
+// It should be registered after fibercommon.ContextLoggerMiddleware and fibercommon.AccessLogMiddleware.
+func Middleware(c *fiber.Ctx) error {
+	info := &operationInfo{}
+	c.Locals(operationKey{}, info)
+	err := c.Next()
+	if info.name != "" {
+		logger := zerolog.Ctx(c.UserContext()).With().Str("gqlOperation", info.name).Logger()
+		c.SetUserContext(logger.WithContext(c.UserContext()))
+	}
+	return err
+}
+
+// OperationName returns the GraphQL operation name recorded for the request, if any.
+func OperationName(ctx context.Context) string {
+	info, ok := ctx.Value(operationKey{}).(*operationInfo)
+	if !ok {
+		return ""
+	}
+	return info.name
+}
+
+// Extension is a gqlgen extension that records the operation name for the Fiber Middleware
+// and adds the operation name and type to the context logger used by resolvers and the error presenter,
+// as gqlOperation and gqlOperationType. It can be used without the Middleware.
+type Extension struct{}
+
+var _ interface {
+	graphql.HandlerExtension
+	graphql.OperationInterceptor
+} = Extension{}
+
+// ExtensionName returns the name of this extension.
+func (Extension) ExtensionName() string {
+	return "OperationLogger"
+}
+
+// Validate validates the GraphQL schema.
+func (Extension) Validate(graphql.ExecutableSchema) error {
+	return nil
+}
+
+// InterceptOperation records the operation name and adds the operation info to the context logger
+// before the operation is executed.
+func (Extension) InterceptOperation(ctx context.Context, next graphql.OperationHandler) graphql.ResponseHandler {
+	opCtx := graphql.GetOperationContext(ctx)
+	name := opCtx.OperationName
+	var operationType string
+	if opCtx.Operation != nil {
+		if name == "" {
+			name = opCtx.Operation.Name
+		}
+		operationType = string(opCtx.Operation.Operation)
+	}
+	if info, ok := ctx.Value(operationKey{}).(*operationInfo); ok {
+		info.name = name
+	}
+	logger := zerolog.Ctx(ctx).With().
+		Str("gqlOperation", name).
+		Str("gqlOperationType", operationType).
+		Logger()
+	return next(logger.WithContext(ctx))
+}
@@ -0,0 +1,81 @@
+package oplog
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/gqlgen/graphql"
+	"github.com/DIMO-Network/server-garage/pkg/fibercommon"
+	"github.com/DIMO-Network/server-garage/pkg/gql/internal/gqltest"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddlewareAddsOperationNameToAccessLog(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	srv := gqltest.NewServer(gqltest.NewExecutableSchema(gqltest.Schema), Extension{})
+
+	app := fiber.New()
+	app.Use(func(c *fiber.Ctx) error {
+		c.SetUserContext(logger.WithContext(context.Background()))
+		return c.Next()
+	})
+	app.Use(fibercommon.ContextLoggerMiddleware)
+	app.Use(fibercommon.AccessLogMiddleware)
+	app.Use(Middleware)
+	app.Post("/query", adaptor.HTTPHandler(srv))
+
+	body := strings.NewReader(`{"query":"query GetHello { hello }","operationName":"GetHello"}`)
+	req := httptest.NewRequest(http.MethodPost, "/query", body)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var accessLogs int
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if strings.Contains(line, `"message":"http request completed"`) {
+			accessLogs++
+			assert.Contains(t, line, `"gqlOperation":"GetHello"`)
+		}
+	}
+	assert.Equal(t, 1, accessLogs)
+	assert.NotContains(t, buf.String(), `"message":"graphql request completed"`)
+}
+
+func TestExtensionTagsResolverLogs(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	es := gqltest.NewExecutableSchema(gqltest.Schema)
+	es.ExecFunc = func(ctx context.Context) graphql.ResponseHandler {
+		return func(ctx context.Context) *graphql.Response {
+			zerolog.Ctx(ctx).Info().Msg("resolving hello")
+			return &graphql.Response{Data: []byte(`{"hello":"world"}`)}
+		}
+	}
+	srv := gqltest.NewServer(es, Extension{})
+
+	req := httptest.NewRequest(http.MethodPost, "/query", strings.NewReader(`{"query":"query GetHello { hello }"}`))
+	req = req.WithContext(logger.WithContext(req.Context()))
+	req.Header.Set("Content-Type", "application/json")
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+
+	logs := buf.String()
+	assert.Contains(t, logs, `"message":"resolving hello"`)
+	assert.Contains(t, logs, `"gqlOperation":"GetHello"`)
+	assert.Contains(t, logs, `"gqlOperationType":"query"`)
+}
+
+func TestOperationNameWithoutMiddleware(t *testing.T) {
+	assert.Empty(t, OperationName(context.Background()))
+}
@@ -0,0 +1,146 @@
+// Package health provides readiness checks that are shared by the monitoring server and fiber apps.
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultTimeout is the timeout of each check when the Checker is created without one.
+const DefaultTimeout = 5 * time.Second
+
+// ErrTimeout is the error of a check that did not return within the timeout of the Checker.
+var ErrTimeout = errors.New("health check timed out")
+
+// CheckFunc returns an error if a dependency is not healthy.
+type CheckFunc func(ctx context.Context) error
+
+// Check is a named CheckFunc.
+type Check struct {
+	Name string
+	Func CheckFunc
+}
+
+// CheckResult is the result of a single check.
+type CheckResult struct {
+	Name    string `json:"name"`
+	Healthy bool   `json:"healthy"`
+	// Error is the error message of an unhealthy check. It may contain internal details such as hosts,
+	// so it should only be returned to trusted clients, see Result.WithoutErrors.
+	Error string `json:"error,omitempty"`
+	// Duration is the time it took to run the check.
+	Duration time.Duration `json:"-"`
+	err      error
+}
+
+// Err returns the error of an unhealthy check.
+func (r CheckResult) Err() error {
+	return r.err
+}
+
+// Result is the result of running all the checks of a Checker.
+type Result struct {
+	// Healthy is true if all the checks are healthy.
+	Healthy bool `json:"healthy"`
+	// Checks are the results of the checks in the order they were added.
+	Checks []CheckResult `json:"checks"`
+}
+
+// Failed returns the names of the unhealthy checks.
+func (r Result) Failed() []string {
+	var failed []string
+	for _, check := range r.Checks {
+		if !check.Healthy {
+			failed = append(failed, check.Name)
+		}
+	}
+	return failed
+}
+
+// WithoutErrors returns a copy of the result without the error messages of the checks,
+// which only reports the names and status of the checks.
+func (r Result) WithoutErrors() Result {
+	checks := make([]CheckResult, len(r.Checks))
+	for i, check := range r.Checks {
+		check.Error = ""
+		checks[i] = check
+	}
+	r.Checks = checks
+	return r
+}
+
+// Checker holds named checks and runs them concurrently.
+// It is safe for concurrent use, checks can be added while it is serving.
+type Checker struct {
+	timeout time.Duration
+	mu      sync.RWMutex
+	checks  []Check
+}
+
+// NewChecker creates a Checker with the given checks. Each check is cancelled and reported unhealthy
+// when it does not return within the timeout. If timeout is not positive, DefaultTimeout is used.
+func NewChecker(timeout time.Duration, checks ...Check) *Checker {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	return &Checker{
+		timeout: timeout,
+		checks:  checks,
+	}
+}
+
+// Add adds a named check.
+func (c *Checker) Add(name string, check CheckFunc) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, Check{Name: name, Func: check})
+}
+
+// Run runs all the checks concurrently and returns their results.
+// A check that ignores the cancellation of its context is reported as timed out but keeps running in the background.
+func (c *Checker) Run(ctx context.Context) Result {
+	c.mu.RLock()
+	checks := append([]Check(nil), c.checks...)
+	c.mu.RUnlock()
+
+	result := Result{Healthy: true, Checks: make([]CheckResult, len(checks))}
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result.Checks[i] = c.runCheck(ctx, check)
+		}()
+	}
+	wg.Wait()
+	for _, check := range result.Checks {
+		if !check.Healthy {
+			result.Healthy = false
+		}
+	}
+	return result
+}
+
+// runCheck runs a check with the timeout of the Checker.
+func (c *Checker) runCheck(ctx context.Context, check Check) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	start := time.Now()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- check.Func(ctx)
+	}()
+	var err error
+	select {
+	case err = <-errs:
+	case <-ctx.Done():
+		err = ErrTimeout
+	}
+	res := CheckResult{Name: check.Name, Healthy: err == nil, Duration: time.Since(start), err: err}
+	if err != nil {
+		res.Error = err.Error()
+	}
+	return res
+}
@@ -0,0 +1,67 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckerRunsChecksConcurrently(t *testing.T) {
+	// Each check waits for all the others to start, so the checks only pass if they run concurrently.
+	const checks = 3
+	var started atomic.Int32
+	allStarted := make(chan struct{})
+	checker := NewChecker(time.Second)
+	for _, name := range []string{"db", "cache", "queue"} {
+		checker.Add(name, func(ctx context.Context) error {
+			if started.Add(1) == checks {
+				close(allStarted)
+			}
+			select {
+			case <-allStarted:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+
+	result := checker.Run(context.Background())
+	require.True(t, result.Healthy)
+	require.Empty(t, result.Failed())
+	require.Len(t, result.Checks, checks)
+	require.Equal(t, "db", result.Checks[0].Name)
+}
+
+func TestCheckerTimeout(t *testing.T) {
+	block := make(chan struct{})
+	t.Cleanup(func() { close(block) })
+	checker := NewChecker(50*time.Millisecond,
+		Check{Name: "ok", Func: func(context.Context) error { return nil }},
+		Check{Name: "failing", Func: func(context.Context) error { return errors.New("connection refused") }},
+		// ignores the cancellation of its context
+		Check{Name: "stuck", Func: func(context.Context) error {
+			<-block
+			return nil
+		}},
+	)
+
+	start := time.Now()
+	result := checker.Run(context.Background())
+	require.Less(t, time.Since(start), time.Second)
+	require.False(t, result.Healthy)
+	require.Equal(t, []string{"failing", "stuck"}, result.Failed())
+	require.True(t, result.Checks[0].Healthy)
+	require.Equal(t, "connection refused", result.Checks[1].Error)
+	require.ErrorIs(t, result.Checks[2].Err(), ErrTimeout)
+
+	withoutErrors := result.WithoutErrors()
+	require.Equal(t, []string{"failing", "stuck"}, withoutErrors.Failed())
+	require.Empty(t, withoutErrors.Checks[1].Error)
+	// The original result is left unchanged.
+	require.Equal(t, "connection refused", result.Checks[1].Error)
+}
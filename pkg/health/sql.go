@@ -0,0 +1,20 @@
+package health
+
+import "context"
+
+// SQLCheckName is the name of the check created by SQLPing.
+const SQLCheckName = "database"
+
+// Pinger is a database connection that can be pinged, such as *sql.DB.
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// SQLPing returns a Check named SQLCheckName that reports the database as unhealthy when it cannot be pinged,
+// e.g. health.NewChecker(0, health.SQLPing(db)).
+func SQLPing(db Pinger) Check {
+	return Check{
+		Name: SQLCheckName,
+		Func: db.PingContext,
+	}
+}
@@ -0,0 +1,28 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDB is a Pinger that returns err.
+type fakeDB struct {
+	err error
+}
+
+func (db fakeDB) PingContext(context.Context) error {
+	return db.err
+}
+
+func TestSQLPing(t *testing.T) {
+	result := NewChecker(0, SQLPing(fakeDB{})).Run(context.Background())
+	require.True(t, result.Healthy)
+
+	result = NewChecker(0, SQLPing(fakeDB{err: errors.New("dial tcp 10.0.0.1:5432: connection refused")})).Run(context.Background())
+	require.False(t, result.Healthy)
+	require.Equal(t, []string{SQLCheckName}, result.Failed())
+	require.Equal(t, "dial tcp 10.0.0.1:5432: connection refused", result.Checks[0].Error)
+}
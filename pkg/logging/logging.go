@@ -1,9 +1,13 @@
 package logging
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
@@ -14,18 +18,97 @@ func GetAndSetDefaultLogger(appName string) zerolog.Logger {
 	return GetAndSetDefaultLoggerWithWriter(appName, os.Stdout)
 }
 
-// GetAndSetDefaultLogger gets the default logger and sets it to the default context logger.
-// It also adds the app name and the commit hash to the logger.
+// GetAndSetDefaultLoggerWithWriter gets the default logger and sets it to the default context logger.
+// It also adds the app name, the short and full commit hash and a dirty flag for builds with uncommitted changes to the logger.
 func GetAndSetDefaultLoggerWithWriter(appName string, writer io.Writer) zerolog.Logger {
-	logger := zerolog.New(writer).With().Timestamp().Str("app", appName).Logger()
-	if info, ok := debug.ReadBuildInfo(); ok {
-		for _, s := range info.Settings {
-			if s.Key == "vcs.revision" && len(s.Value) == 40 {
-				logger = logger.With().Str("commit", s.Value[:7]).Logger()
-				break
+	logger := newLogger(appName, writer)
+	zerolog.DefaultContextLogger = &logger
+	return logger
+}
+
+// NewConsoleLogger creates a human-readable colored logger that writes to os.Stdout, intended for local development.
+// It adds the same app name and commit hash fields as the JSON logger but does not set the default context logger.
+func NewConsoleLogger(appName string) zerolog.Logger {
+	return newConsoleLogger(appName, os.Stdout)
+}
+
+func newConsoleLogger(appName string, out io.Writer) zerolog.Logger {
+	return newLogger(appName, zerolog.ConsoleWriter{Out: out, TimeFormat: time.RFC3339})
+}
+
+// newLogger creates a logger with a timestamp, the app name and the commit hash if available.
+func newLogger(appName string, writer io.Writer) zerolog.Logger {
+	logCtx := zerolog.New(writer).With().Timestamp().Str("app", appName)
+	if info, ok := readBuildInfo(); ok {
+		vcs := parseVCSInfo(info)
+		if vcs.commit != "" {
+			logCtx = logCtx.Str("commit", vcs.commit[:7]).Str("fullCommit", vcs.commit)
+		}
+		if vcs.hasModified {
+			logCtx = logCtx.Bool("dirty", vcs.modified)
+		}
+	}
+	return logCtx.Logger()
+}
+
+// readBuildInfo is a seam for tests to inject build info.
+var readBuildInfo = debug.ReadBuildInfo
+
+// vcsInfo is the version control information embedded in the binary.
+type vcsInfo struct {
+	commit      string
+	modified    bool
+	hasModified bool
+}
+
+// parseVCSInfo reads the full commit hash and whether the build had uncommitted changes from the build settings.
+func parseVCSInfo(info *debug.BuildInfo) vcsInfo {
+	var vcs vcsInfo
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			if len(s.Value) == 40 {
+				vcs.commit = s.Value
 			}
+		case "vcs.modified":
+			vcs.hasModified = true
+			vcs.modified = s.Value == "true"
 		}
 	}
+	return vcs
+}
+
+// GetAndSetDefaultLoggerWithLevel gets the default logger with the given level and sets it to the default context logger.
+// It also adds the app name and the commit hash to the logger.
+func GetAndSetDefaultLoggerWithLevel(appName string, level zerolog.Level) zerolog.Logger {
+	logger := GetAndSetDefaultLoggerWithWriter(appName, os.Stdout).Level(level)
 	zerolog.DefaultContextLogger = &logger
 	return logger
 }
+
+// ParseLevel parses a log level string such as the value of a LOG_LEVEL environment variable.
+// The level is case-insensitive and an empty string returns zerolog.InfoLevel.
+func ParseLevel(level string) (zerolog.Level, error) {
+	level = strings.TrimSpace(level)
+	if level == "" {
+		return zerolog.InfoLevel, nil
+	}
+	return zerolog.ParseLevel(strings.ToLower(level))
+}
+
+// ErrorCauses returns the message of each error in the chain of err, starting with err itself.
+func ErrorCauses(err error) []string {
+	var causes []string
+	for ; err != nil; err = errors.Unwrap(err) {
+		causes = append(causes, err.Error())
+	}
+	return causes
+}
+
+// DetachedContext returns a new background context that carries the context logger of ctx.
+// The returned context is not cancelled when ctx is and has no deadline, which makes it suitable for
+// fire-and-forget work spawned from a request while keeping the logs correlated with the request.
+// Other values of ctx are not carried over, since they may be tied to the lifetime of the request.
+func DetachedContext(ctx context.Context) context.Context {
+	return zerolog.Ctx(ctx).WithContext(context.Background())
+}
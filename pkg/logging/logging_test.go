@@ -0,0 +1,169 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"runtime/debug"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetachedContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).With().Str("requestId", "abc123").Logger()
+
+	ctx, cancel := context.WithTimeout(logger.WithContext(context.Background()), time.Minute)
+	detached := DetachedContext(ctx)
+	cancel()
+
+	_, hasDeadline := detached.Deadline()
+	require.False(t, hasDeadline)
+	require.NoError(t, detached.Err())
+
+	zerolog.Ctx(detached).Info().Msg("background work")
+	require.Contains(t, buf.String(), `"requestId":"abc123"`)
+}
+
+func TestGetAndSetDefaultLoggerWithLevel(t *testing.T) {
+	prev := zerolog.DefaultContextLogger
+	t.Cleanup(func() { zerolog.DefaultContextLogger = prev })
+
+	logger := GetAndSetDefaultLoggerWithLevel("test-app", zerolog.WarnLevel)
+	require.Equal(t, zerolog.WarnLevel, logger.GetLevel())
+	require.Equal(t, zerolog.WarnLevel, zerolog.DefaultContextLogger.GetLevel())
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected zerolog.Level
+		wantErr  bool
+	}{
+		{input: "", expected: zerolog.InfoLevel},
+		{input: "debug", expected: zerolog.DebugLevel},
+		{input: " WARN ", expected: zerolog.WarnLevel},
+		{input: "Error", expected: zerolog.ErrorLevel},
+		{input: "verbose", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			level, err := ParseLevel(tt.input)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, level)
+		})
+	}
+}
+
+func TestNewConsoleLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newConsoleLogger("test-app", &buf)
+	logger.Info().Msg("hello")
+
+	require.False(t, json.Valid(buf.Bytes()))
+	require.Contains(t, buf.String(), "test-app")
+	require.Contains(t, buf.String(), "hello")
+}
+
+func TestBuildInfoFields(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	prev := readBuildInfo
+	t.Cleanup(func() { readBuildInfo = prev })
+	readBuildInfo = func() (*debug.BuildInfo, bool) {
+		return &debug.BuildInfo{Settings: []debug.BuildSetting{
+			{Key: "vcs.revision", Value: commit},
+			{Key: "vcs.modified", Value: "true"},
+		}}, true
+	}
+
+	var buf bytes.Buffer
+	logger := newLogger("test-app", &buf)
+	logger.Info().Msg("hello")
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "0123456", entry["commit"])
+	require.Equal(t, commit, entry["fullCommit"])
+	require.Equal(t, true, entry["dirty"])
+}
+
+func TestGetAndSetDefaultLoggerWithWriterBuildInfo(t *testing.T) {
+	prevBuildInfo := readBuildInfo
+	prevLogger := zerolog.DefaultContextLogger
+	t.Cleanup(func() {
+		readBuildInfo = prevBuildInfo
+		zerolog.DefaultContextLogger = prevLogger
+	})
+
+	tests := []struct {
+		name      string
+		buildInfo func() (*debug.BuildInfo, bool)
+		want      map[string]any
+	}{
+		{
+			name: "full commit",
+			buildInfo: func() (*debug.BuildInfo, bool) {
+				return &debug.BuildInfo{Settings: []debug.BuildSetting{
+					{Key: "vcs.revision", Value: "0123456789abcdef0123456789abcdef01234567"},
+				}}, true
+			},
+			want: map[string]any{"commit": "0123456", "fullCommit": "0123456789abcdef0123456789abcdef01234567"},
+		},
+		{
+			name: "short revision",
+			buildInfo: func() (*debug.BuildInfo, bool) {
+				return &debug.BuildInfo{Settings: []debug.BuildSetting{
+					{Key: "vcs.revision", Value: "0123456"},
+					{Key: "vcs.modified", Value: "false"},
+				}}, true
+			},
+			want: map[string]any{"dirty": false},
+		},
+		{
+			name:      "no build info",
+			buildInfo: func() (*debug.BuildInfo, bool) { return nil, false },
+			want:      map[string]any{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readBuildInfo = tt.buildInfo
+			var buf bytes.Buffer
+			logger := GetAndSetDefaultLoggerWithWriter("test-app", &buf)
+			logger.Info().Msg("hello")
+
+			var entry map[string]any
+			require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+			for _, key := range []string{"commit", "fullCommit", "dirty"} {
+				want, ok := tt.want[key]
+				if !ok {
+					require.NotContains(t, entry, key)
+					continue
+				}
+				require.Equal(t, want, entry[key])
+			}
+			require.Equal(t, "test-app", entry["app"])
+		})
+	}
+}
+
+func TestParseVCSInfo(t *testing.T) {
+	vcs := parseVCSInfo(&debug.BuildInfo{Settings: []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "short"},
+		{Key: "vcs.modified", Value: "false"},
+	}})
+	require.Empty(t, vcs.commit)
+	require.True(t, vcs.hasModified)
+	require.False(t, vcs.modified)
+
+	vcs = parseVCSInfo(&debug.BuildInfo{})
+	require.False(t, vcs.hasModified)
+}
@@ -1,19 +1,130 @@
 package monserver
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/pprof"
+	"runtime"
 	runtimepprof "runtime/pprof"
+	"strings"
 
+	"github.com/DIMO-Network/server-garage/pkg/health"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 )
 
-func NewMonitoringServer(logger *zerolog.Logger, enablePprof bool) *http.ServeMux {
+// ReadinessCheck returns an error if a dependency is not ready to serve traffic.
+type ReadinessCheck = health.CheckFunc
+
+// Option configures the monitoring server.
+type Option func(*config)
+
+// config holds internal configuration for the monitoring server.
+type config struct {
+	readinessChecks  []health.Check
+	healthCheckers   []*health.Checker
+	inFlightCounters map[string]func() int64
+	debugHandlers    []debugHandler
+	mutexFraction    int
+	blockRate        int
+	pathPrefix       string
+}
+
+type debugHandler struct {
+	pattern string
+	handler http.Handler
+}
+
+// WithDebugHandler returns an Option that registers an additional handler for the given pattern, e.g. "POST /debug/jwks/refresh".
+// Like the pprof endpoints, the handler is only registered when pprof is enabled.
+func WithDebugHandler(pattern string, handler http.Handler) Option {
+	return func(c *config) {
+		c.debugHandlers = append(c.debugHandlers, debugHandler{pattern: pattern, handler: handler})
+	}
+}
+
+// WithInFlightCounter returns an Option that adds an in-flight request count to the GET /debug/stats endpoint.
+// The endpoint is only available when pprof is enabled. For example, use metrics.InFlightRequests for GraphQL requests.
+func WithInFlightCounter(name string, count func() int64) Option {
+	return func(c *config) {
+		if c.inFlightCounters == nil {
+			c.inFlightCounters = map[string]func() int64{}
+		}
+		c.inFlightCounters[name] = count
+	}
+}
+
+// WithMutexProfileFraction returns an Option that enables mutex profiling with runtime.SetMutexProfileFraction when
+// pprof is enabled, so GET /debug/pprof/mutex reports contention. On average 1/rate of the contention events are
+// reported. Profiling adds a small cost to every contended mutex unlock, a rate of 100 or more is cheap enough for
+// production, a rate of 1 records every event and is meant for debugging.
+func WithMutexProfileFraction(rate int) Option {
+	return func(c *config) { c.mutexFraction = rate }
+}
+
+// WithBlockProfileRate returns an Option that enables block profiling with runtime.SetBlockProfileRate when
+// pprof is enabled, so GET /debug/pprof/block reports goroutines blocked on channels and sync primitives.
+// The profiler samples one blocking event per rate nanoseconds spent blocked. Every sampled event captures a stack
+// trace, so low rates are expensive, e.g. a rate of 1 records every event. A rate of 10000 (10µs) or more is
+// usually cheap enough for production.
+func WithBlockProfileRate(rate int) Option {
+	return func(c *config) { c.blockRate = rate }
+}
+
+// WithPathPrefix returns an Option that registers all the endpoints under the prefix, e.g. with the prefix "/internal"
+// the endpoints are GET /internal/health, GET /internal/metrics, GET /internal/debug/pprof/ and so on.
+// This is useful when the monitoring server is reverse proxied behind a shared ingress.
+// The patterns of the debug handlers added with WithDebugHandler are prefixed as well.
+func WithPathPrefix(prefix string) Option {
+	return func(c *config) {
+		prefix = strings.TrimSuffix(prefix, "/")
+		if prefix != "" && !strings.HasPrefix(prefix, "/") {
+			prefix = "/" + prefix
+		}
+		c.pathPrefix = prefix
+	}
+}
+
+// prefixPattern adds the prefix to the path of a ServeMux pattern with an optional method, e.g. "POST /debug/x".
+func prefixPattern(prefix, pattern string) string {
+	if method, path, ok := strings.Cut(pattern, " "); ok {
+		return method + " " + prefix + path
+	}
+	return prefix + pattern
+}
+
+// stats is the response of the GET /debug/stats endpoint.
+type stats struct {
+	InFlightRequests map[string]int64 `json:"inFlightRequests"`
+}
+
+// WithReadinessCheck returns an Option that adds a check to the GET /ready endpoint.
+// The endpoint reports ready only when all checks return nil. The checks run concurrently with health.DefaultTimeout.
+func WithReadinessCheck(name string, check ReadinessCheck) Option {
+	return func(c *config) {
+		c.readinessChecks = append(c.readinessChecks, health.Check{Name: name, Func: check})
+	}
+}
+
+// WithHealthChecker returns an Option that adds the checks of the checker to the GET /ready endpoint.
+// Share the checker with the readiness route of the fiber app, see fibercommon.NewReadinessHandler,
+// so both report the same readiness.
+func WithHealthChecker(checker *health.Checker) Option {
+	return func(c *config) {
+		c.healthCheckers = append(c.healthCheckers, checker)
+	}
+}
+
+func NewMonitoringServer(logger *zerolog.Logger, enablePprof bool, opts ...Option) *http.ServeMux {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+
 	mux := http.NewServeMux()
 
-	mux.HandleFunc("GET /", func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path != "/" {
+	mux.HandleFunc("GET "+cfg.pathPrefix+"/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != cfg.pathPrefix+"/" {
 			http.NotFound(w, r)
 			return
 		}
@@ -22,30 +133,80 @@ func NewMonitoringServer(logger *zerolog.Logger, enablePprof bool) *http.ServeMu
 		_, _ = w.Write([]byte("ok"))
 	})
 
-	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+	liveness := func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
 		_, _ = w.Write([]byte("healthy"))
-	})
+	}
+	// /livez and /readyz are the Kubernetes spellings of the probe endpoints
+	mux.HandleFunc("GET "+cfg.pathPrefix+"/health", liveness)
+	mux.HandleFunc("GET "+cfg.pathPrefix+"/livez", liveness)
 
-	mux.Handle("GET /metrics", promhttp.Handler())
+	checkers := append([]*health.Checker{health.NewChecker(0, cfg.readinessChecks...)}, cfg.healthCheckers...)
+	readiness := func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		var failed []string
+		for _, checker := range checkers {
+			result := checker.Run(r.Context())
+			for _, check := range result.Checks {
+				if !check.Healthy && logger != nil {
+					logger.Debug().Err(check.Err()).Str("check", check.Name).Msg("readiness check failed")
+				}
+			}
+			failed = append(failed, result.Failed()...)
+		}
+		if len(failed) > 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("not ready: " + strings.Join(failed, ", ")))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ready"))
+	}
+	mux.HandleFunc("GET "+cfg.pathPrefix+"/ready", readiness)
+	mux.HandleFunc("GET "+cfg.pathPrefix+"/readyz", readiness)
+
+	mux.Handle("GET "+cfg.pathPrefix+"/metrics", promhttp.Handler())
 
 	// Add pprof handlers if enabled
 	if enablePprof {
 		// Index page and base profiles
-		mux.HandleFunc("GET /debug/pprof/", pprof.Index)
-		mux.HandleFunc("GET /debug/pprof/cmdline", pprof.Cmdline)
-		mux.HandleFunc("GET /debug/pprof/profile", pprof.Profile)
-		mux.HandleFunc("GET /debug/pprof/symbol", pprof.Symbol)
-		mux.HandleFunc("GET /debug/pprof/trace", pprof.Trace)
+		// the index serves the named profiles by their path without the prefix
+		mux.Handle("GET "+cfg.pathPrefix+"/debug/pprof/", http.StripPrefix(cfg.pathPrefix, http.HandlerFunc(pprof.Index)))
+		mux.HandleFunc("GET "+cfg.pathPrefix+"/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("GET "+cfg.pathPrefix+"/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("GET "+cfg.pathPrefix+"/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("GET "+cfg.pathPrefix+"/debug/pprof/trace", pprof.Trace)
+
+		// the mutex and block profiles are empty unless their rates are set
+		if cfg.mutexFraction > 0 {
+			runtime.SetMutexProfileFraction(cfg.mutexFraction)
+		}
+		if cfg.blockRate > 0 {
+			runtime.SetBlockProfileRate(cfg.blockRate)
+		}
 
 		// add specialized profiles
 		profiles := runtimepprof.Profiles()
 		for _, profile := range profiles {
-			mux.Handle("GET /debug/pprof/"+profile.Name(), pprof.Handler(profile.Name()))
+			mux.Handle("GET "+cfg.pathPrefix+"/debug/pprof/"+profile.Name(), pprof.Handler(profile.Name()))
+		}
+
+		mux.HandleFunc("GET "+cfg.pathPrefix+"/debug/stats", func(w http.ResponseWriter, r *http.Request) {
+			resp := stats{InFlightRequests: make(map[string]int64, len(cfg.inFlightCounters))}
+			for name, count := range cfg.inFlightCounters {
+				resp.InFlightRequests[name] = count()
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(resp)
+		})
+
+		for _, h := range cfg.debugHandlers {
+			mux.Handle(prefixPattern(cfg.pathPrefix, h.pattern), h.handler)
 		}
+
 		if logger != nil {
-			logger.Info().Str("endpoint", "GET /debug/pprof").Msg("pprof profiling enabled on monitoring server")
+			logger.Info().Str("endpoint", "GET "+cfg.pathPrefix+"/debug/pprof").Msg("pprof profiling enabled on monitoring server")
 		}
 	}
 
@@ -1,11 +1,16 @@
 package monserver
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"runtime"
 	"strings"
 	"testing"
+	"time"
 
+	"github.com/DIMO-Network/server-garage/pkg/health"
 	"github.com/rs/zerolog"
 )
 
@@ -153,3 +158,170 @@ func TestMonitoringServerPprofDisabled(t *testing.T) {
 		})
 	}
 }
+
+func TestMonitoringServerReadiness(t *testing.T) {
+	var ready bool
+	mux := NewMonitoringServer(nil, false, WithReadinessCheck("dependency", func(context.Context) error {
+		if !ready {
+			return errors.New("dependency not ready")
+		}
+		return nil
+	}))
+
+	req := httptest.NewRequest("GET", "/ready", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+
+	ready = true
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if w.Body.String() != "ready" {
+		t.Errorf("expected body 'ready', got %q", w.Body.String())
+	}
+}
+
+func TestMonitoringServerHealthChecker(t *testing.T) {
+	checker := health.NewChecker(0)
+	mux := NewMonitoringServer(nil, false, WithHealthChecker(checker))
+
+	req := httptest.NewRequest("GET", "/ready", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+
+	// checks added after the server is created are run as well
+	checker.Add("db", func(context.Context) error { return errors.New("connection refused") })
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %d, got %d", http.StatusServiceUnavailable, w.Code)
+	}
+	if w.Body.String() != "not ready: db" {
+		t.Errorf("expected body 'not ready: db', got %q", w.Body.String())
+	}
+}
+
+// blockOnChannel blocks the calling goroutine on a channel receive for d.
+func blockOnChannel(d time.Duration) {
+	ch := make(chan struct{})
+	go func() {
+		time.Sleep(d)
+		close(ch)
+	}()
+	<-ch
+}
+
+func TestMonitoringServerBlockProfile(t *testing.T) {
+	t.Cleanup(func() {
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+	})
+	mux := NewMonitoringServer(nil, true, WithBlockProfileRate(1), WithMutexProfileFraction(1))
+	if rate := runtime.SetMutexProfileFraction(-1); rate != 1 {
+		t.Errorf("expected mutex profile fraction 1, got %d", rate)
+	}
+
+	blockOnChannel(20 * time.Millisecond)
+
+	req := httptest.NewRequest("GET", "/debug/pprof/block?debug=1", nil)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	if w.Code != http.StatusOK {
+		t.Errorf("expected status %d, got %d", http.StatusOK, w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "blockOnChannel") {
+		t.Errorf("expected the block profile to contain the blocked call, got %q", w.Body.String())
+	}
+}
+
+func TestMonitoringServerPathPrefix(t *testing.T) {
+	debug := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("refreshed"))
+	})
+	for _, prefix := range []string{"/internal", "/internal/", "internal"} {
+		t.Run(prefix, func(t *testing.T) {
+			mux := NewMonitoringServer(nil, true, WithPathPrefix(prefix), WithDebugHandler("POST /debug/refresh", debug))
+
+			endpoints := []struct {
+				method string
+				path   string
+				want   int
+				body   string
+			}{
+				{method: "GET", path: "/internal/", want: http.StatusOK, body: "ok"},
+				{method: "GET", path: "/internal/health", want: http.StatusOK, body: "healthy"},
+				{method: "GET", path: "/internal/ready", want: http.StatusOK, body: "ready"},
+				{method: "GET", path: "/internal/metrics", want: http.StatusOK},
+				{method: "GET", path: "/internal/debug/pprof/", want: http.StatusOK},
+				{method: "GET", path: "/internal/debug/pprof/heap", want: http.StatusOK},
+				{method: "GET", path: "/internal/debug/pprof/allocs?debug=1", want: http.StatusOK},
+				{method: "GET", path: "/internal/debug/pprof/unknown", want: http.StatusNotFound},
+				{method: "GET", path: "/internal/debug/stats", want: http.StatusOK},
+				{method: "POST", path: "/internal/debug/refresh", want: http.StatusOK, body: "refreshed"},
+				{method: "GET", path: "/internal/nonexistent", want: http.StatusNotFound},
+				{method: "GET", path: "/", want: http.StatusNotFound},
+				{method: "GET", path: "/health", want: http.StatusNotFound},
+				{method: "GET", path: "/metrics", want: http.StatusNotFound},
+			}
+			for _, endpoint := range endpoints {
+				req := httptest.NewRequest(endpoint.method, endpoint.path, nil)
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, req)
+				if w.Code != endpoint.want {
+					t.Errorf("%s %s: expected status %d, got %d", endpoint.method, endpoint.path, endpoint.want, w.Code)
+				}
+				if endpoint.body != "" && w.Body.String() != endpoint.body {
+					t.Errorf("%s %s: expected body %q, got %q", endpoint.method, endpoint.path, endpoint.body, w.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func TestMonitoringServerProbeAliases(t *testing.T) {
+	var ready bool
+	mux := NewMonitoringServer(nil, false, WithReadinessCheck("dependency", func(context.Context) error {
+		if !ready {
+			return errors.New("dependency not ready")
+		}
+		return nil
+	}))
+
+	probes := []struct {
+		path string
+		want int
+		body string
+	}{
+		{path: "/health", want: http.StatusOK, body: "healthy"},
+		{path: "/livez", want: http.StatusOK, body: "healthy"},
+		{path: "/ready", want: http.StatusServiceUnavailable, body: "not ready: dependency"},
+		{path: "/readyz", want: http.StatusServiceUnavailable, body: "not ready: dependency"},
+	}
+	for _, probe := range probes {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", probe.path, nil))
+		if w.Code != probe.want {
+			t.Errorf("%s: expected status %d, got %d", probe.path, probe.want, w.Code)
+		}
+		if w.Body.String() != probe.body {
+			t.Errorf("%s: expected body %q, got %q", probe.path, probe.body, w.Body.String())
+		}
+	}
+
+	ready = true
+	for _, path := range []string{"/ready", "/readyz"} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != http.StatusOK {
+			t.Errorf("%s: expected status %d, got %d", path, http.StatusOK, w.Code)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package richerrors
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestIsCodeError(t *testing.T) {
+	notFound := ErrorWithCodef(http.StatusNotFound, "vehicle not found", "no vehicle with id %d", 1)
+	wrapped := fmt.Errorf("handler failed: %w", notFound)
+
+	require.ErrorIs(t, notFound, CodeError(http.StatusNotFound))
+	require.ErrorIs(t, wrapped, CodeError(http.StatusNotFound))
+	require.NotErrorIs(t, wrapped, CodeError(http.StatusBadRequest))
+	require.NotErrorIs(t, errors.New("plain error"), CodeError(http.StatusNotFound))
+	require.NotErrorIs(t, Errorf("no code", "no code"), CodeError(0))
+}
+
+func TestCodeErrorString(t *testing.T) {
+	notFound := CodeError(http.StatusNotFound)
+	require.Equal(t, "Not Found", notFound.Error())
+	require.Equal(t, "Not Found", notFound.String())
+	require.Equal(t, "Not Found (code 404)", notFound.DetailedString())
+	require.Equal(t, "Not Found", fmt.Sprintf("%v", notFound))
+	require.Equal(t, "unknown error", Error{}.Error())
+}
+
+func TestErrorsWithCode(t *testing.T) {
+	errMissingName := errors.New("missing name")
+	errInvalidVIN := errors.New("invalid vin")
+
+	err := fmt.Errorf("validate vehicle: %w", ErrorsWithCode(http.StatusBadRequest, "invalid vehicle", errMissingName, errInvalidVIN))
+
+	require.ErrorIs(t, err, errMissingName)
+	require.ErrorIs(t, err, errInvalidVIN)
+	require.ErrorIs(t, err, CodeError(http.StatusBadRequest))
+
+	richErr, ok := AsRichError(err)
+	require.True(t, ok)
+	require.Equal(t, http.StatusBadRequest, richErr.Code)
+	require.Equal(t, "invalid vehicle", richErr.ExternalMsg)
+	require.Contains(t, richErr.Error(), "missing name")
+	require.Contains(t, richErr.Error(), "invalid vin")
+}
+
+func TestMarshalJSON(t *testing.T) {
+	richErr := ErrorWithCodef(http.StatusNotFound, "vehicle not found", "no vehicle with id %d", 1)
+	data, err := json.Marshal(richErr)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"code":404,"message":"vehicle not found"}`, string(data))
+
+	// The internal error is never included.
+	data, err = json.Marshal(Error{Code: http.StatusInternalServerError, Err: errors.New("boom")})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"code":500,"message":"Internal Server Error"}`, string(data))
+
+	// Errors without an external message fall back to the status text.
+	data, err = json.Marshal(CodeError(http.StatusNotFound))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"code":404,"message":"Not Found"}`, string(data))
+
+	var decoded Error
+	require.NoError(t, json.Unmarshal([]byte(`{"code":404,"message":"vehicle not found"}`), &decoded))
+	require.Equal(t, http.StatusNotFound, decoded.Code)
+	require.Equal(t, "vehicle not found", decoded.ExternalMsg)
+
+	data, err = json.Marshal(richErr.WithErrorCode("NOT_FOUND"))
+	require.NoError(t, err)
+	require.JSONEq(t, `{"code":404,"message":"vehicle not found","errorCode":"NOT_FOUND"}`, string(data))
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, "NOT_FOUND", decoded.ErrorCode)
+}
+
+func TestValidationError(t *testing.T) {
+	fields := map[string]string{"vin": "must be 17 characters"}
+	err := fmt.Errorf("create vehicle: %w", NewValidationError("invalid vehicle", fields))
+
+	require.EqualError(t, err, "create vehicle: invalid vehicle")
+	require.ErrorIs(t, err, CodeError(http.StatusBadRequest))
+	validation, ok := ValidationFieldsOf(err)
+	require.True(t, ok)
+	require.Equal(t, fields, validation)
+
+	// Error stays comparable, so it can still be compared and used as a map key.
+	validationErr := NewValidationError("invalid vehicle", fields)
+	copied := validationErr
+	require.True(t, copied == validationErr)
+	require.NotPanics(t, func() { _ = map[error]bool{validationErr: true} })
+}
+
+func TestRetryAfterOf(t *testing.T) {
+	_, ok := RetryAfterOf(errors.New("plain error"))
+	require.False(t, ok)
+
+	_, ok = RetryAfterOf(ErrorWithCodef(http.StatusTooManyRequests, "slow down", "rate limited"))
+	require.False(t, ok)
+
+	rateLimited := ErrorWithCodef(http.StatusTooManyRequests, "slow down", "rate limited").WithRetryAfter(30 * time.Second)
+	retryAfter, ok := RetryAfterOf(fmt.Errorf("handler failed: %w", rateLimited))
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, retryAfter)
+
+	// The duration is found on a rich error wrapped by another rich error.
+	outer := Error{Code: http.StatusServiceUnavailable, ExternalMsg: "unavailable", Err: rateLimited}
+	retryAfter, ok = RetryAfterOf(outer)
+	require.True(t, ok)
+	require.Equal(t, 30*time.Second, retryAfter)
+}
+
+func TestMarshalTextRedactsInternalError(t *testing.T) {
+	richErr := ErrorWithCodef(http.StatusNotFound, "vehicle not found", "database query failed: user_id=%d not found", 123)
+
+	text, err := richErr.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "vehicle not found", string(text))
+
+	text, err = Error{Code: http.StatusTooManyRequests, Err: errors.New("limiter state")}.MarshalText()
+	require.NoError(t, err)
+	require.Equal(t, "Too Many Requests", string(text))
+
+	require.Contains(t, richErr.DetailedString(), "user_id=123")
+	require.Contains(t, richErr.DetailedString(), "404")
+}
+
+func TestGRPCCodeForHTTPStatus(t *testing.T) {
+	tests := []struct {
+		status   int
+		expected codes.Code
+	}{
+		{status: http.StatusBadRequest, expected: codes.InvalidArgument},
+		{status: http.StatusUnauthorized, expected: codes.Unauthenticated},
+		{status: http.StatusForbidden, expected: codes.PermissionDenied},
+		{status: http.StatusNotFound, expected: codes.NotFound},
+		{status: http.StatusTooManyRequests, expected: codes.ResourceExhausted},
+		{status: http.StatusTeapot, expected: codes.InvalidArgument},
+		{status: http.StatusBadGateway, expected: codes.Internal},
+		{status: http.StatusServiceUnavailable, expected: codes.Unavailable},
+		{status: http.StatusMovedPermanently, expected: codes.Unknown},
+	}
+
+	for _, tt := range tests {
+		t.Run(http.StatusText(tt.status), func(t *testing.T) {
+			require.Equal(t, tt.expected, GRPCCodeForHTTPStatus(tt.status))
+		})
+	}
+}
+
+func TestResponseOf(t *testing.T) {
+	richErr := ErrorWithCodef(http.StatusNotFound, "vehicle not found", "no vehicle with id %d", 1).WithRetryAfter(1500 * time.Millisecond)
+	resp := ResponseOf(fmt.Errorf("get vehicle: %w", richErr), "internal error")
+	require.Equal(t, Response{
+		HTTPStatus:        http.StatusNotFound,
+		GRPCCode:          codes.NotFound,
+		Message:           "vehicle not found",
+		RetryAfterSeconds: 2,
+	}, resp)
+
+	resp = ResponseOf(errors.New("connection refused"), "internal error")
+	require.Equal(t, Response{
+		HTTPStatus: http.StatusInternalServerError,
+		GRPCCode:   codes.Internal,
+		Message:    "internal error",
+	}, resp)
+
+	// a wrapping error without a code keeps the code of the wrapped error
+	resp = ResponseOf(Error{ExternalMsg: "vehicle unavailable", Err: CodeError(http.StatusServiceUnavailable)}, "internal error")
+	require.Equal(t, Response{
+		HTTPStatus: http.StatusServiceUnavailable,
+		GRPCCode:   codes.Unavailable,
+		Message:    "vehicle unavailable",
+	}, resp)
+}
+
+func TestGRPCStatus(t *testing.T) {
+	err := fmt.Errorf("get vehicle: %w", ErrorWithCodef(http.StatusNotFound, "vehicle not found", "no vehicle with id %d", 1))
+	require.Equal(t, codes.NotFound, status.Code(err))
+	require.Equal(t, codes.Unknown, status.Code(errors.New("plain error")))
+
+	st, ok := status.FromError(ResponseOf(err, "internal error").GRPCStatus().Err())
+	require.True(t, ok)
+	require.Equal(t, codes.NotFound, st.Code())
+	require.Equal(t, "vehicle not found", st.Message())
+}
+
+func TestIsClientAndServerError(t *testing.T) {
+	tests := []struct {
+		name        string
+		err         error
+		clientError bool
+		serverError bool
+	}{
+		{name: "bad request", err: CodeError(http.StatusBadRequest), clientError: true},
+		{name: "last client error", err: CodeError(499), clientError: true},
+		{name: "first server error", err: CodeError(http.StatusInternalServerError), serverError: true},
+		{name: "last server error", err: CodeError(599), serverError: true},
+		{name: "redirect", err: CodeError(http.StatusFound)},
+		{name: "unknown code", err: CodeError(600)},
+		{name: "plain error", err: errors.New("connection refused"), serverError: true},
+		{name: "nil error"},
+		{
+			name:        "code from wrapped rich error",
+			err:         Error{ExternalMsg: "invalid vehicle", Err: ErrorWithCodef(http.StatusNotFound, "not found", "no vehicle")},
+			clientError: true,
+		},
+		{
+			name:        "wrapped with fmt",
+			err:         fmt.Errorf("get vehicle: %w", CodeError(http.StatusTooManyRequests)),
+			clientError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.clientError, IsClientError(tt.err))
+			require.Equal(t, tt.serverError, IsServerError(tt.err))
+		})
+	}
+}
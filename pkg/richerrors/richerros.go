@@ -1,8 +1,11 @@
 package richerrors
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net/http"
+	"time"
 )
 
 // Error is an error that contains a code, an external message, and a wrapped error.
@@ -10,9 +13,20 @@ type Error struct {
 	Code        int
 	ExternalMsg string
 	Err         error
+	// RetryAfter is an optional hint for how long the client should wait before retrying.
+	RetryAfter time.Duration
+	// ErrorCode is an optional machine-readable code such as NOT_FOUND, matching the codes used by the GraphQL API.
+	ErrorCode string
+	// fields are the optional per-field validation messages of NewValidationError, see ValidationFieldsOf.
+	// They are kept behind a pointer so Error stays comparable.
+	fields *map[string]string
 }
 
+// ErrorCodeValidation is the ErrorCode of errors created with NewValidationError.
+const ErrorCodeValidation = "BAD_USER_INPUT"
+
 // Error returns the ExternalMsg if it is set, otherwise it returns the error message of the wrapped error.
+// An error with neither, such as a CodeError, returns the status text of its code.
 func (e Error) Error() string {
 	if e.ExternalMsg != "" && e.Err != nil {
 		return fmt.Sprintf("%s: %s", e.ExternalMsg, e.Err.Error())
@@ -20,7 +34,13 @@ func (e Error) Error() string {
 	if e.ExternalMsg != "" {
 		return e.ExternalMsg
 	}
-	return e.Err.Error()
+	if e.Err != nil {
+		return e.Err.Error()
+	}
+	if text := http.StatusText(e.Code); text != "" {
+		return text
+	}
+	return "unknown error"
 }
 
 // String implements the fmt.Stringer interface.
@@ -28,9 +48,19 @@ func (e Error) String() string {
 	return e.Error()
 }
 
+// DetailedString returns the full error message including the wrapped error and the code if set.
+// It is intended for logs and must not be returned to clients.
+func (e Error) DetailedString() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("%s (code %d)", e.Error(), e.Code)
+	}
+	return e.Error()
+}
+
 // MarshalText implements the encoding.TextMarshaler interface.
+// Only the external message is emitted so internal error details are not exposed to clients, see externalMessage.
 func (e Error) MarshalText() ([]byte, error) {
-	return []byte(e.Error()), nil
+	return []byte(e.externalMessage()), nil
 }
 
 // UnmarshalText implements the encoding.TextUnmarshaler interface.
@@ -41,11 +71,73 @@ func (e *Error) UnmarshalText(text []byte) error {
 	return nil
 }
 
+// jsonError is the JSON representation of an Error.
+type jsonError struct {
+	Code      int    `json:"code"`
+	Message   string `json:"message"`
+	ErrorCode string `json:"errorCode,omitempty"`
+}
+
+// MarshalJSON implements the json.Marshaler interface.
+// Only the external message is emitted as the message so internal error details are not exposed to clients,
+// see externalMessage.
+func (e Error) MarshalJSON() ([]byte, error) {
+	return json.Marshal(jsonError{Code: e.Code, Message: e.externalMessage(), ErrorCode: e.ErrorCode})
+}
+
+// externalMessage returns the ExternalMsg of the error, or the status text of its HTTP status if it is empty,
+// so marshaled errors always carry a message.
+func (e Error) externalMessage() string {
+	if e.ExternalMsg != "" {
+		return e.ExternalMsg
+	}
+	return http.StatusText(e.HTTPStatus())
+}
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (e *Error) UnmarshalJSON(data []byte) error {
+	var jsonErr jsonError
+	if err := json.Unmarshal(data, &jsonErr); err != nil {
+		return err
+	}
+	e.Code = jsonErr.Code
+	e.ExternalMsg = jsonErr.Message
+	e.ErrorCode = jsonErr.ErrorCode
+	e.Err = errors.New(jsonErr.Message)
+	return nil
+}
+
 // Unwrap returns the wrapped error to support errors.Is and errors.As.
 func (e Error) Unwrap() error {
 	return e.Err
 }
 
+// Is reports whether the target is a code only Error created with CodeError that matches the code of this error.
+// This allows errors.Is(err, CodeError(http.StatusNotFound)) to match any rich error in the chain with that code.
+func (e Error) Is(target error) bool {
+	var t Error
+	switch v := target.(type) {
+	case Error:
+		t = v
+	case *Error:
+		if v == nil {
+			return false
+		}
+		t = *v
+	default:
+		return false
+	}
+	if t.Code == 0 || t.ExternalMsg != "" || t.Err != nil {
+		return false
+	}
+	return e.Code == t.Code
+}
+
+// CodeError creates an Error with only the code set, for use as an errors.Is target.
+func CodeError(code int) Error {
+	return Error{Code: code}
+}
+
 // Errorf creates a new RichError with the given external message and format.
 func Errorf(externalMsg string, format string, args ...interface{}) Error {
 	return Error{
@@ -60,6 +152,102 @@ func ErrorWithCodef(code int, externalMsg string, format string, args ...interfa
 	return richErr
 }
 
+// ErrorsWithCode creates a new RichError with the given code and external message that wraps all the given errors.
+// The errors are joined with errors.Join so errors.Is and errors.As match any of them.
+func ErrorsWithCode(code int, externalMsg string, errs ...error) Error {
+	return Error{
+		Code:        code,
+		ExternalMsg: externalMsg,
+		Err:         errors.Join(errs...),
+	}
+}
+
+// NewValidationError creates a 400 Error with per-field validation messages keyed by field name.
+// The fields are returned to clients, as validation in HTTP responses and as the validation extension of GraphQL errors.
+func NewValidationError(externalMsg string, fields map[string]string) Error {
+	return Error{
+		Code:        http.StatusBadRequest,
+		ExternalMsg: externalMsg,
+		ErrorCode:   ErrorCodeValidation,
+		fields:      &fields,
+	}
+}
+
+// WithRetryAfter returns a copy of the error with the given retry after duration.
+func (e Error) WithRetryAfter(d time.Duration) Error {
+	e.RetryAfter = d
+	return e
+}
+
+// WithErrorCode returns a copy of the error with the given machine-readable error code.
+func (e Error) WithErrorCode(code string) Error {
+	e.ErrorCode = code
+	return e
+}
+
+// RetryAfterOf returns the first retry after duration set on a RichError in the error chain.
+func RetryAfterOf(err error) (time.Duration, bool) {
+	for err != nil {
+		richErr, ok := AsRichError(err)
+		if !ok {
+			return 0, false
+		}
+		if richErr.RetryAfter > 0 {
+			return richErr.RetryAfter, true
+		}
+		err = richErr.Err
+	}
+	return 0, false
+}
+
+// ValidationFieldsOf returns the first non empty per-field validation messages of a RichError in the error chain,
+// see NewValidationError.
+func ValidationFieldsOf(err error) (map[string]string, bool) {
+	for err != nil {
+		richErr, ok := AsRichError(err)
+		if !ok {
+			return nil, false
+		}
+		if richErr.fields != nil && len(*richErr.fields) > 0 {
+			return *richErr.fields, true
+		}
+		err = richErr.Err
+	}
+	return nil, false
+}
+
+// CodeOf returns the first non zero code of a RichError in the error chain.
+// Errors without a code are treated as internal errors and return http.StatusInternalServerError, like the HTTP error handler.
+// It returns 0 for a nil error.
+func CodeOf(err error) int {
+	if err == nil {
+		return 0
+	}
+	for err != nil {
+		richErr, ok := AsRichError(err)
+		if !ok {
+			break
+		}
+		if richErr.Code != 0 {
+			return richErr.Code
+		}
+		err = richErr.Err
+	}
+	return http.StatusInternalServerError
+}
+
+// IsClientError reports whether the effective code of err, see CodeOf, is a 4xx client error.
+func IsClientError(err error) bool {
+	code := CodeOf(err)
+	return code >= 400 && code < 500
+}
+
+// IsServerError reports whether the effective code of err, see CodeOf, is a 5xx server error.
+func IsServerError(err error) bool {
+	code := CodeOf(err)
+	return code >= 500 && code < 600
+}
+
 // IsRichError checks if the error wraps a RichError.
 func IsRichError(err error) bool {
 	return errors.As(err, &Error{})
@@ -0,0 +1,145 @@
+package richerrors
+
+import (
+	"net/http"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// httpStatusGRPCCode maps HTTP status codes to gRPC codes.
+//
+//	HTTP status                    gRPC code
+//	200 OK                         OK
+//	400 Bad Request                InvalidArgument
+//	401 Unauthorized               Unauthenticated
+//	403 Forbidden                  PermissionDenied
+//	404 Not Found                  NotFound
+//	408 Request Timeout            DeadlineExceeded
+//	409 Conflict                   Aborted
+//	412 Precondition Failed        FailedPrecondition
+//	429 Too Many Requests          ResourceExhausted
+//	499 Client Closed Request      Canceled
+//	500 Internal Server Error      Internal
+//	501 Not Implemented            Unimplemented
+//	503 Service Unavailable        Unavailable
+//	504 Gateway Timeout            DeadlineExceeded
+//
+// Any other 4xx status maps to InvalidArgument, any other 5xx status to Internal and everything else to Unknown.
+var httpStatusGRPCCode = map[int]codes.Code{
+	http.StatusOK:                  codes.OK,
+	http.StatusBadRequest:          codes.InvalidArgument,
+	http.StatusUnauthorized:        codes.Unauthenticated,
+	http.StatusForbidden:           codes.PermissionDenied,
+	http.StatusNotFound:            codes.NotFound,
+	http.StatusRequestTimeout:      codes.DeadlineExceeded,
+	http.StatusConflict:            codes.Aborted,
+	http.StatusPreconditionFailed:  codes.FailedPrecondition,
+	http.StatusTooManyRequests:     codes.ResourceExhausted,
+	499:                            codes.Canceled,
+	http.StatusInternalServerError: codes.Internal,
+	http.StatusNotImplemented:      codes.Unimplemented,
+	http.StatusServiceUnavailable:  codes.Unavailable,
+	http.StatusGatewayTimeout:      codes.DeadlineExceeded,
+}
+
+// HTTPStatus returns the HTTP status code of the error, http.StatusInternalServerError if no code is set.
+func (e Error) HTTPStatus() int {
+	if e.Code == 0 {
+		return http.StatusInternalServerError
+	}
+	return e.Code
+}
+
+// GRPCCode returns the gRPC status code of the error derived from HTTPStatus, see GRPCCodeForHTTPStatus.
+func (e Error) GRPCCode() codes.Code {
+	return GRPCCodeForHTTPStatus(e.HTTPStatus())
+}
+
+// GRPCStatus returns the gRPC status of the error with its ExternalMsg, see ResponseOf, so status.Code maps
+// a RichError anywhere in the chain. status.FromError uses the full message of a wrapped error,
+// return ResponseOf(err, msg).GRPCStatus().Err() from gRPC handlers to only expose the ExternalMsg.
+func (e Error) GRPCStatus() *status.Status {
+	return ResponseOf(e, "").GRPCStatus()
+}
+
+// GRPCCodeForHTTPStatus returns the gRPC status code for the given HTTP status code.
+func GRPCCodeForHTTPStatus(httpStatus int) codes.Code {
+	if code, ok := httpStatusGRPCCode[httpStatus]; ok {
+		return code
+	}
+	switch {
+	case httpStatus >= 400 && httpStatus < 500:
+		return codes.InvalidArgument
+	case httpStatus >= 500 && httpStatus < 600:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
+
+// joinedMessages returns the message of each error joined by err, for example with errors.Join or ErrorsWithCode.
+// It returns nil if err does not join multiple errors.
+func joinedMessages(err error) []string {
+	joined, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return nil
+	}
+	var messages []string
+	for _, e := range joined.Unwrap() {
+		messages = append(messages, e.Error())
+	}
+	return messages
+}
+
+// Response is the protocol independent representation of an error returned to clients.
+// Both the HTTP error handler and gRPC status mapping are derived from it so the two protocols stay consistent.
+type Response struct {
+	// HTTPStatus is the HTTP status code.
+	HTTPStatus int
+	// GRPCCode is the gRPC status code.
+	GRPCCode codes.Code
+	// Message is the client facing message.
+	Message string
+	// ErrorCode is the machine-readable error code, empty if not set.
+	ErrorCode string
+	// Details are the messages of the errors joined by a client error, such as per-field validation errors.
+	// They are only set for 4xx errors since the wrapped errors of server errors may contain internal details.
+	Details []string
+	// Fields are the per-field validation messages of a client error, see NewValidationError.
+	Fields map[string]string
+	// RetryAfterSeconds is the retry after hint rounded up to whole seconds, 0 if not set.
+	RetryAfterSeconds int
+}
+
+// ResponseOf builds the client Response for err. Only the ExternalMsg of a RichError is exposed,
+// errors that do not wrap a RichError are returned as an internal error with defaultMsg.
+// The status codes are derived from the effective code of err, see CodeOf, so a RichError without a code that wraps
+// one with a code, e.g. to override the message, keeps the wrapped code.
+func ResponseOf(err error, defaultMsg string) Response {
+	richErr, ok := AsRichError(err)
+	if !ok {
+		richErr = Error{ExternalMsg: defaultMsg}
+	}
+	httpStatus := CodeOf(err)
+	resp := Response{
+		HTTPStatus: httpStatus,
+		GRPCCode:   GRPCCodeForHTTPStatus(httpStatus),
+		Message:    richErr.ExternalMsg,
+		ErrorCode:  richErr.ErrorCode,
+	}
+	if resp.HTTPStatus >= 400 && resp.HTTPStatus < 500 {
+		resp.Details = joinedMessages(richErr.Err)
+		resp.Fields, _ = ValidationFieldsOf(err)
+	}
+	if retryAfter, ok := RetryAfterOf(err); ok {
+		resp.RetryAfterSeconds = int((retryAfter + time.Second - 1) / time.Second)
+	}
+	return resp
+}
+
+// GRPCStatus returns the gRPC status of the response with its GRPCCode and Message.
+func (r Response) GRPCStatus() *status.Status {
+	return status.New(r.GRPCCode, r.Message)
+}
@@ -0,0 +1,43 @@
+package runner
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// RunGRPCAndHTTP starts a server in a new goroutine that serves gRPC and HTTP on the same address and shuts it down
+// when the context is cancelled. HTTP/2 requests with a gRPC content type are routed to grpcHandler, all other
+// requests, such as those of a REST gateway, to httpHandler. The server accepts HTTP/1.1 and unencrypted HTTP/2 (h2c),
+// which gRPC clients use for insecure connections.
+//
+// A *grpc.Server implements http.Handler and can be passed as grpcHandler. Its ServeHTTP mode does not support
+// all gRPC features, see the documentation of grpc.Server.ServeHTTP, use RunGRPC on a separate port if they are needed.
+//
+// Unlike RunHandler, the shutdown is not aborted by the cancelled context. HTTP/2 connections are never idle for the
+// server, so the shutdown sends them a GOAWAY frame and waits for their in flight requests to finish.
+// Long lived streams must end when the context is cancelled.
+func RunGRPCAndHTTP(ctx context.Context, group *errgroup.Group, grpcHandler, httpHandler http.Handler, addr string, opts ...RunOption) {
+	var protocols http.Protocols
+	protocols.SetHTTP1(true)
+	protocols.SetUnencryptedHTTP2(true)
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   grpcOrHTTPHandler(grpcHandler, httpHandler),
+		Protocols: &protocols,
+	}
+	runHTTPServer(ctx, group, srv, srv.ListenAndServe, context.WithoutCancel(ctx), newLifecycle(KindGRPCAndHTTP, opts))
+}
+
+// grpcOrHTTPHandler routes gRPC requests to grpcHandler and all other requests to httpHandler.
+func grpcOrHTTPHandler(grpcHandler, httpHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcHandler.ServeHTTP(w, r)
+			return
+		}
+		httpHandler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestRunGRPCAndHTTP(t *testing.T) {
+	// grpcHandler stands in for a *grpc.Server, which serves gRPC over HTTP/2 with ServeHTTP.
+	grpcHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		_, _ = io.WriteString(w, "grpc "+r.Proto)
+		w.Header().Set("Grpc-Status", "0")
+	})
+	httpHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "http "+r.Proto)
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group, ctx := errgroup.WithContext(ctx)
+	addr := freeAddr(t)
+	RunGRPCAndHTTP(ctx, group, grpcHandler, httpHandler, addr)
+
+	// gRPC clients use HTTP/2 with prior knowledge on insecure connections.
+	var h2c http.Protocols
+	h2c.SetUnencryptedHTTP2(true)
+	grpcClient := &http.Client{Transport: &http.Transport{Protocols: &h2c}}
+	call := func(client *http.Client, contentType string) (string, error) {
+		req, err := http.NewRequest(http.MethodPost, "http://"+addr+"/pkg.Service/Method", strings.NewReader(""))
+		if err != nil {
+			return "", err
+		}
+		req.Header.Set("Content-Type", contentType)
+		resp, err := client.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if resp.Trailer.Get("Grpc-Status") != "" {
+			body = append(body, " status "+resp.Trailer.Get("Grpc-Status")...)
+		}
+		return string(body), err
+	}
+
+	require.Eventually(t, func() bool {
+		_, err := call(http.DefaultClient, "application/json")
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	body, err := call(grpcClient, "application/grpc+proto")
+	require.NoError(t, err)
+	require.Equal(t, "grpc HTTP/2.0 status 0", body)
+
+	body, err = call(http.DefaultClient, "application/json")
+	require.NoError(t, err)
+	require.Equal(t, "http HTTP/1.1", body)
+
+	// HTTP/2 requests without a gRPC content type, such as gateway calls, are served by the HTTP handler.
+	body, err = call(grpcClient, "application/json")
+	require.NoError(t, err)
+	require.Equal(t, "http HTTP/2.0", body)
+
+	cancel()
+	require.NoError(t, group.Wait())
+}
@@ -0,0 +1,115 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rs/zerolog"
+)
+
+// Server kinds used as the kind label of the lifecycle metrics.
+const (
+	KindFiber       = "fiber"
+	KindGRPC        = "grpc"
+	KindHTTP        = "http"
+	KindGRPCAndHTTP = "grpc_http"
+)
+
+// Metrics records the lifecycle of the servers started by the Run helpers, see WithMetrics.
+type Metrics struct {
+	up               *prometheus.GaugeVec
+	shutdownDuration *prometheus.HistogramVec
+	shutdownErrors   *prometheus.CounterVec
+}
+
+// NewMetrics creates the lifecycle metrics and registers them with reg:
+//   - server_up{kind} is the number of servers of the kind that are serving.
+//   - server_shutdown_duration_seconds{kind} is the duration of the graceful shutdowns.
+//   - server_shutdown_errors_total{kind} is the number of graceful shutdowns that returned an error.
+//
+// A registry should only be passed once, the metrics can be shared by all the servers of a process.
+func NewMetrics(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		up: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "server_up",
+			Help: "Number of servers that are serving, categorized by kind.",
+		}, []string{"kind"}),
+		shutdownDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "server_shutdown_duration_seconds",
+			Help:    "Duration of the graceful shutdown of a server in seconds, categorized by kind.",
+			Buckets: []float64{0.01, 0.1, 0.5, 1, 2.5, 5, 10, 30, 60},
+		}, []string{"kind"}),
+		shutdownErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "server_shutdown_errors_total",
+			Help: "Total number of graceful shutdowns of a server that failed, categorized by kind.",
+		}, []string{"kind"}),
+	}
+	for _, collector := range []prometheus.Collector{m.up, m.shutdownDuration, m.shutdownErrors} {
+		if err := reg.Register(collector); err != nil {
+			return nil, fmt.Errorf("failed to register runner metrics: %w", err)
+		}
+	}
+	return m, nil
+}
+
+// RunOption configures the Run helpers.
+type RunOption func(*runConfig)
+
+// runConfig holds internal configuration for the Run helpers.
+type runConfig struct {
+	metrics *Metrics
+}
+
+// WithMetrics returns a RunOption that records the lifecycle of the server in the metrics.
+func WithMetrics(metrics *Metrics) RunOption {
+	return func(c *runConfig) { c.metrics = metrics }
+}
+
+// lifecycle records the lifecycle metrics of a server. It does nothing if no metrics are configured.
+type lifecycle struct {
+	metrics *Metrics
+	kind    string
+}
+
+func newLifecycle(kind string, opts []RunOption) lifecycle {
+	var cfg runConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return lifecycle{metrics: cfg.metrics, kind: kind}
+}
+
+// serve counts the server as up while serve runs. Servers of the same kind share the gauge, so it is
+// incremented rather than set and a server that stops does not mark the others as down.
+func (l lifecycle) serve(serve func() error) error {
+	if l.metrics == nil {
+		return serve()
+	}
+	up := l.metrics.up.WithLabelValues(l.kind)
+	up.Inc()
+	defer up.Dec()
+	return serve()
+}
+
+// failed logs the error that stopped the server with the context logger and returns it. The first error of the
+// group cancels the context of the other servers, so the log shows which server caused the shutdown.
+func (l lifecycle) failed(ctx context.Context, addr string, err error) error {
+	zerolog.Ctx(ctx).Error().Err(err).Str("serverKind", l.kind).Str("serverAddr", addr).Msg("Server failed")
+	return err
+}
+
+// shutdown records the duration and the failure of shutdown.
+func (l lifecycle) shutdown(shutdown func() error) error {
+	if l.metrics == nil {
+		return shutdown()
+	}
+	start := time.Now()
+	err := shutdown()
+	l.metrics.shutdownDuration.WithLabelValues(l.kind).Observe(time.Since(start).Seconds())
+	if err != nil {
+		l.metrics.shutdownErrors.WithLabelValues(l.kind).Inc()
+	}
+	return err
+}
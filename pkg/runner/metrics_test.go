@@ -0,0 +1,59 @@
+package runner
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+func TestRunMetrics(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	metrics, err := NewMetrics(reg)
+	require.NoError(t, err)
+	_, err = NewMetrics(reg)
+	require.Error(t, err, "registering the metrics twice with a registry should fail")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	group, ctx := errgroup.WithContext(ctx)
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := RunHandlerListener(ctx, group, http.NotFoundHandler(), lis, WithMetrics(metrics))
+	otherLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	otherAddr := RunHandlerListener(ctx, group, http.NotFoundHandler(), otherLis, WithMetrics(metrics))
+
+	for _, addr := range []net.Addr{addr, otherAddr} {
+		resp, err := http.Get("http://" + addr.String())
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	require.Equal(t, 2.0, testutil.ToFloat64(metrics.up.WithLabelValues(KindHTTP)))
+
+	cancel()
+	require.NoError(t, group.Wait())
+
+	families, err := reg.Gather()
+	require.NoError(t, err)
+	values := make(map[string]float64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			require.Equal(t, KindHTTP, metric.GetLabel()[0].GetValue())
+			switch {
+			case metric.GetGauge() != nil:
+				values[family.GetName()] = metric.GetGauge().GetValue()
+			case metric.GetHistogram() != nil:
+				values[family.GetName()] = float64(metric.GetHistogram().GetSampleCount())
+			}
+		}
+	}
+	require.Equal(t, map[string]float64{
+		"server_up":                        0,
+		"server_shutdown_duration_seconds": 2,
+	}, values)
+}
@@ -0,0 +1,80 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// migrationPollInterval is how often replicas that are not the leader check if the migration completed.
+var migrationPollInterval = time.Second
+
+// LeaderElector coordinates a one time task, such as a migration, across replicas.
+// Implementations are typically backed by a database advisory lock or a Kubernetes lease.
+type LeaderElector interface {
+	// Acquire attempts to become the leader without blocking. It returns true if leadership was acquired.
+	Acquire(ctx context.Context) (bool, error)
+	// Release gives up leadership.
+	Release(ctx context.Context) error
+	// Completed returns true if the task has been marked completed by a leader.
+	Completed(ctx context.Context) (bool, error)
+	// MarkCompleted records that the task completed so other replicas stop waiting.
+	MarkCompleted(ctx context.Context) error
+}
+
+// RunMigration runs migrate on exactly one replica.
+// The replica that acquires leadership runs the migration and marks it completed,
+// all other replicas wait until the migration has completed or the context is cancelled.
+func RunMigration(ctx context.Context, elector LeaderElector, migrate func(ctx context.Context) error) error {
+	logger := zerolog.Ctx(ctx)
+	for {
+		completed, err := elector.Completed(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check migration status: %w", err)
+		}
+		if completed {
+			return nil
+		}
+		leader, err := elector.Acquire(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to acquire migration leadership: %w", err)
+		}
+		if leader {
+			return runMigrationAsLeader(ctx, elector, migrate)
+		}
+		logger.Debug().Msg("waiting for migration leader to complete")
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for migration: %w", ctx.Err())
+		case <-time.After(migrationPollInterval):
+		}
+	}
+}
+
+func runMigrationAsLeader(ctx context.Context, elector LeaderElector, migrate func(ctx context.Context) error) (retErr error) {
+	defer func() {
+		// release even if the context is cancelled so another replica can take over
+		if err := elector.Release(context.WithoutCancel(ctx)); err != nil {
+			retErr = errors.Join(retErr, fmt.Errorf("failed to release migration leadership: %w", err))
+		}
+	}()
+	// another leader may have completed the migration between the status check and acquiring leadership
+	completed, err := elector.Completed(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check migration status: %w", err)
+	}
+	if completed {
+		return nil
+	}
+	zerolog.Ctx(ctx).Info().Msg("acquired migration leadership, running migration")
+	if err := migrate(ctx); err != nil {
+		return fmt.Errorf("failed to run migration: %w", err)
+	}
+	if err := elector.MarkCompleted(ctx); err != nil {
+		return fmt.Errorf("failed to mark migration completed: %w", err)
+	}
+	return nil
+}
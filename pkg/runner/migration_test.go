@@ -0,0 +1,74 @@
+package runner
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+// fakeElector is an in memory LeaderElector shared by all replicas in a test.
+type fakeElector struct {
+	mu        sync.Mutex
+	leader    bool
+	completed bool
+}
+
+func (f *fakeElector) Acquire(context.Context) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.leader {
+		return false, nil
+	}
+	f.leader = true
+	return true, nil
+}
+
+func (f *fakeElector) Release(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.leader = false
+	return nil
+}
+
+func (f *fakeElector) Completed(context.Context) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.completed, nil
+}
+
+func (f *fakeElector) MarkCompleted(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.completed = true
+	return nil
+}
+
+func TestRunMigrationRunsOnce(t *testing.T) {
+	origInterval := migrationPollInterval
+	migrationPollInterval = 5 * time.Millisecond
+	t.Cleanup(func() { migrationPollInterval = origInterval })
+
+	elector := &fakeElector{}
+	var runs atomic.Int32
+	migrate := func(context.Context) error {
+		runs.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		return nil
+	}
+
+	group, ctx := errgroup.WithContext(context.Background())
+	for range 5 {
+		group.Go(func() error {
+			return RunMigration(ctx, elector, migrate)
+		})
+	}
+	require.NoError(t, group.Wait())
+	require.Equal(t, int32(1), runs.Load())
+	require.True(t, elector.completed)
+	require.False(t, elector.leader)
+}
@@ -8,24 +8,160 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/rs/zerolog"
 	"golang.org/x/sync/errgroup"
 )
 
+// SignalError is the cause of the context returned by NewSignalGroup when it is cancelled by an OS signal.
+type SignalError struct {
+	Signal os.Signal
+}
+
+// Error returns the name of the received signal.
+func (e SignalError) Error() string {
+	return "received signal " + e.Signal.String()
+}
+
+// ErrBindFailed is wrapped by the errors of the Run helpers when the server cannot listen on its address,
+// e.g. because the port is already in use. The underlying net error is wrapped as well, so
+// errors.Is(err, syscall.EADDRINUSE) reports whether the port is in use.
+var ErrBindFailed = errors.New("failed to bind listener")
+
+// wrapBindError wraps err with ErrBindFailed if it is the error of a failed listen.
+func wrapBindError(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "listen" {
+		return fmt.Errorf("%w: %w", ErrBindFailed, err)
+	}
+	return err
+}
+
+// ErrDraining is returned by DrainState.ReadinessCheck while the shutdown is delayed.
+var ErrDraining = errors.New("shutting down")
+
+// DrainState reports whether a signal group received a shutdown signal and is waiting for its shutdown delay.
+// The zero value is ready to use.
+type DrainState struct {
+	draining atomic.Bool
+}
+
+// Draining reports whether a shutdown signal was received.
+func (d *DrainState) Draining() bool {
+	return d.draining.Load()
+}
+
+// ReadinessCheck returns ErrDraining once a shutdown signal was received, so readiness probes fail during the shutdown delay.
+// It can be passed to monserver.WithReadinessCheck.
+func (d *DrainState) ReadinessCheck(context.Context) error {
+	if d.Draining() {
+		return ErrDraining
+	}
+	return nil
+}
+
+// SignalGroupOption configures NewSignalGroup.
+type SignalGroupOption func(*signalGroupConfig)
+
+// signalGroupConfig holds internal configuration for NewSignalGroup.
+type signalGroupConfig struct {
+	shutdownDelay time.Duration
+	drainState    *DrainState
+}
+
+// WithShutdownDelay returns a SignalGroupOption that keeps serving for the given duration after a shutdown signal
+// before the context is cancelled. In Kubernetes this gives the endpoints controller time to remove the pod
+// while it still accepts requests, so in flight rollouts do not drop connections.
+// A second signal or the failure of a group function ends the delay early. The default is no delay.
+//
+// Combined with WithDrainState and a readiness check on the DrainState, the readiness probe fails as soon as
+// the signal is received, while the servers keep serving until the delay ends. For the probe to take the pod
+// out of rotation before the servers stop, the delay should be longer than the probe periodSeconds times its
+// failureThreshold, and terminationGracePeriodSeconds must cover the delay plus the graceful shutdown.
+// Kubernetes also removes terminating pods from endpoints without waiting for the probe, the delay covers the
+// time it takes load balancers and service meshes to observe that.
+func WithShutdownDelay(delay time.Duration) SignalGroupOption {
+	return func(c *signalGroupConfig) { c.shutdownDelay = delay }
+}
+
+// WithDrainState returns a SignalGroupOption that marks the state as draining when a shutdown signal is received.
+// Use DrainState.ReadinessCheck to report not ready during the shutdown delay.
+func WithDrainState(state *DrainState) SignalGroupOption {
+	return func(c *signalGroupConfig) { c.drainState = state }
+}
+
 // NewSignalGroup creates a new context and error group that handles OS interrupt signals.
-func NewSignalGroup(backgroundContext context.Context) (context.Context, *errgroup.Group) {
-	ctx, cancel := signal.NotifyContext(backgroundContext, os.Interrupt, syscall.SIGTERM)
+// The reason of the shutdown is logged: the received signal (SIGINT or SIGTERM), the error of the
+// first failed group function, the cancellation of the background context, or the clean stop of every function.
+// When cancelled by a signal, context.Cause of the returned context is a SignalError.
+func NewSignalGroup(backgroundContext context.Context, opts ...SignalGroupOption) (context.Context, *errgroup.Group) {
+	var cfg signalGroupConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	ctx, cancel := context.WithCancelCause(backgroundContext)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	group, gCtx := errgroup.WithContext(ctx)
 	go func() {
-		<-ctx.Done()
-		zerolog.Ctx(backgroundContext).Info().Msg("Received interrupt signal, shutting down...")
-		cancel()
+		defer signal.Stop(signals)
+		logger := zerolog.Ctx(backgroundContext)
+		select {
+		case sig := <-signals:
+			logger.Info().
+				Str("shutdownReason", "signal").
+				Str("signal", sig.String()).
+				Msgf("Received %s signal, shutting down...", sig)
+			if cfg.drainState != nil {
+				cfg.drainState.draining.Store(true)
+			}
+			waitShutdownDelay(gCtx, logger, signals, cfg.shutdownDelay)
+			cancel(SignalError{Signal: sig})
+		case <-gCtx.Done():
+			cause := context.Cause(gCtx)
+			switch {
+			case ctx.Err() != nil:
+				logger.Info().
+					Str("shutdownReason", "context").
+					AnErr("cause", context.Cause(ctx)).
+					Msg("Context cancelled, shutting down...")
+			case errors.Is(cause, context.Canceled):
+				// errgroup cancels the context with context.Canceled when every function returned nil.
+				logger.Info().
+					Str("shutdownReason", "stopped").
+					Msg("All components stopped, shutting down...")
+			default:
+				// The failed server is logged with its kind and address by the Run functions.
+				logger.Warn().
+					Str("shutdownReason", "error").
+					Err(cause).
+					Msg("Component failed, shutting down...")
+			}
+			cancel(nil)
+		}
 	}()
-	group, gCtx := errgroup.WithContext(ctx)
 	return gCtx, group
 }
 
+// waitShutdownDelay waits for the shutdown delay, a second signal, or the cancellation of ctx.
+func waitShutdownDelay(ctx context.Context, logger *zerolog.Logger, signals <-chan os.Signal, delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	logger.Info().Dur("shutdownDelay", delay).Msg("Delaying shutdown while draining traffic...")
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case sig := <-signals:
+		logger.Info().Str("signal", sig.String()).Msg("Received second signal, skipping shutdown delay")
+	case <-ctx.Done():
+	}
+}
+
 // FiberApp is an interface that represents a Fiber application.
 type FiberApp interface {
 	Listen(addr string) error
@@ -33,20 +169,47 @@ type FiberApp interface {
 }
 
 // RunFiber starts a Fiber application in a new goroutine and shuts it down when the context is cancelled.
-func RunFiber(ctx context.Context, group *errgroup.Group, fiberApp FiberApp, addr string) {
+func RunFiber(ctx context.Context, group *errgroup.Group, fiberApp FiberApp, addr string, opts ...RunOption) {
+	l := newLifecycle(KindFiber, opts)
+	group.Go(func() error {
+		if err := l.serve(func() error { return fiberApp.Listen(addr) }); err != nil {
+			return l.failed(ctx, addr, fmt.Errorf("failed to start server: %w", wrapBindError(err)))
+		}
+		return nil
+	})
 	group.Go(func() error {
-		if err := fiberApp.Listen(addr); err != nil {
-			return fmt.Errorf("failed to start server: %w", err)
+		<-ctx.Done()
+		if err := l.shutdown(fiberApp.Shutdown); err != nil {
+			return fmt.Errorf("failed to shutdown server: %w", err)
+		}
+		return nil
+	})
+}
+
+// FiberListenerApp is an interface that represents a Fiber application that serves on a listener.
+type FiberListenerApp interface {
+	Listener(ln net.Listener) error
+	Shutdown() error
+}
+
+// RunFiberListener starts a Fiber application on the listener in a new goroutine and shuts it down when the context is cancelled.
+// It returns the address of the listener, which is the chosen port when the listener was bound to port 0.
+func RunFiberListener(ctx context.Context, group *errgroup.Group, fiberApp FiberListenerApp, lis net.Listener, opts ...RunOption) net.Addr {
+	l := newLifecycle(KindFiber, opts)
+	group.Go(func() error {
+		if err := l.serve(func() error { return fiberApp.Listener(lis) }); err != nil {
+			return l.failed(ctx, lis.Addr().String(), fmt.Errorf("failed to start server: %w", err))
 		}
 		return nil
 	})
 	group.Go(func() error {
 		<-ctx.Done()
-		if err := fiberApp.Shutdown(); err != nil {
+		if err := l.shutdown(fiberApp.Shutdown); err != nil {
 			return fmt.Errorf("failed to shutdown server: %w", err)
 		}
 		return nil
 	})
+	return lis.Addr()
 }
 
 // GRPCServer is an interface that represents a gRPC server.
@@ -56,39 +219,83 @@ type GRPCServer interface {
 }
 
 // RunGRPC starts a gRPC server in a new goroutine and shuts it down when the context is cancelled.
-func RunGRPC(ctx context.Context, group *errgroup.Group, grpcServer GRPCServer, addr string) {
+func RunGRPC(ctx context.Context, group *errgroup.Group, grpcServer GRPCServer, addr string, opts ...RunOption) {
+	l := newLifecycle(KindGRPC, opts)
 	group.Go(func() error {
 		lis, err := net.Listen("tcp", addr)
 		if err != nil {
-			return fmt.Errorf("failed to listen on gRPC port %s: %w", addr, err)
+			return l.failed(ctx, addr, fmt.Errorf("%w on gRPC port %s: %w", ErrBindFailed, addr, err))
 		}
-		if err := grpcServer.Serve(lis); err != nil {
-			return fmt.Errorf("gRPC server failed to serve: %w", err)
+		if err := l.serve(func() error { return grpcServer.Serve(lis) }); err != nil {
+			return l.failed(ctx, addr, fmt.Errorf("gRPC server failed to serve: %w", err))
 		}
 		return nil
 	})
 	group.Go(func() error {
 		<-ctx.Done()
-		grpcServer.GracefulStop()
+		return l.shutdown(gracefulStop(grpcServer))
+	})
+}
+
+// RunGRPCListener starts a gRPC server on the listener in a new goroutine and shuts it down when the context is cancelled.
+// It returns the address of the listener, which is the chosen port when the listener was bound to port 0.
+func RunGRPCListener(ctx context.Context, group *errgroup.Group, grpcServer GRPCServer, lis net.Listener, opts ...RunOption) net.Addr {
+	l := newLifecycle(KindGRPC, opts)
+	group.Go(func() error {
+		if err := l.serve(func() error { return grpcServer.Serve(lis) }); err != nil {
+			return l.failed(ctx, lis.Addr().String(), fmt.Errorf("gRPC server failed to serve: %w", err))
+		}
 		return nil
 	})
+	group.Go(func() error {
+		<-ctx.Done()
+		return l.shutdown(gracefulStop(grpcServer))
+	})
+	return lis.Addr()
+}
+
+// gracefulStop returns a shutdown function that gracefully stops the gRPC server.
+func gracefulStop(grpcServer GRPCServer) func() error {
+	return func() error {
+		grpcServer.GracefulStop()
+		return nil
+	}
 }
 
 // RunHandler starts a HTTP server in a new goroutine and shuts it down when the context is cancelled.
-func RunHandler(ctx context.Context, group *errgroup.Group, handler http.Handler, addr string) {
+func RunHandler(ctx context.Context, group *errgroup.Group, handler http.Handler, addr string, opts ...RunOption) {
 	srv := &http.Server{
 		Addr:    addr,
 		Handler: handler,
 	}
+	runHTTPServer(ctx, group, srv, srv.ListenAndServe, ctx, newLifecycle(KindHTTP, opts))
+}
+
+// RunHandlerListener starts a HTTP server on the listener in a new goroutine and shuts it down when the context is cancelled.
+// It returns the address of the listener, which is the chosen port when the listener was bound to port 0.
+// The listener is closed when the server shuts down.
+func RunHandlerListener(ctx context.Context, group *errgroup.Group, handler http.Handler, lis net.Listener, opts ...RunOption) net.Addr {
+	srv := &http.Server{
+		// the address is only used in logs, the server serves on the listener
+		Addr:    lis.Addr().String(),
+		Handler: handler,
+	}
+	runHTTPServer(ctx, group, srv, func() error { return srv.Serve(lis) }, ctx, newLifecycle(KindHTTP, opts))
+	return lis.Addr()
+}
+
+// runHTTPServer runs serve in a new goroutine and shuts the server down with shutdownCtx when ctx is cancelled.
+// http.ErrServerClosed is treated as a clean shutdown, other errors are logged with the address of the server.
+func runHTTPServer(ctx context.Context, group *errgroup.Group, srv *http.Server, serve func() error, shutdownCtx context.Context, l lifecycle) {
 	group.Go(func() error {
-		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-			return fmt.Errorf("failed to run server: %w", err)
+		if err := l.serve(serve); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return l.failed(ctx, srv.Addr, fmt.Errorf("failed to run server: %w", wrapBindError(err)))
 		}
 		return nil
 	})
 	group.Go(func() error {
 		<-ctx.Done()
-		if err := srv.Shutdown(ctx); err != nil {
+		if err := l.shutdown(func() error { return srv.Shutdown(shutdownCtx) }); err != nil {
 			return fmt.Errorf("failed to shutdown server: %w", err)
 		}
 		return nil
@@ -0,0 +1,270 @@
+package runner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DIMO-Network/server-garage/pkg/monserver"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+)
+
+// syncBuffer is a bytes.Buffer that is safe to write from the signal goroutine while the test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return bytes.Clone(b.buf.Bytes())
+}
+
+func TestNewSignalGroupSignalReason(t *testing.T) {
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	ctx, group := NewSignalGroup(logger.WithContext(context.Background()))
+	group.Go(func() error {
+		<-ctx.Done()
+		return nil
+	})
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	require.NoError(t, group.Wait())
+
+	var signalErr SignalError
+	require.ErrorAs(t, context.Cause(ctx), &signalErr)
+	require.Equal(t, syscall.SIGTERM, signalErr.Signal)
+	require.Eventually(t, func() bool {
+		return bytes.Contains(buf.Bytes(), []byte(`"shutdownReason":"signal"`)) &&
+			bytes.Contains(buf.Bytes(), []byte(`"signal":"terminated"`))
+	}, time.Second, 10*time.Millisecond)
+	require.Contains(t, string(buf.Bytes()), `"level":"info"`)
+	require.NotContains(t, string(buf.Bytes()), `"level":"error"`)
+}
+
+func TestNewSignalGroupCleanStop(t *testing.T) {
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	_, group := NewSignalGroup(logger.WithContext(context.Background()))
+	group.Go(func() error {
+		return nil
+	})
+
+	require.NoError(t, group.Wait())
+	require.Eventually(t, func() bool {
+		return bytes.Contains(buf.Bytes(), []byte(`"shutdownReason":"stopped"`))
+	}, time.Second, 10*time.Millisecond)
+	require.Contains(t, string(buf.Bytes()), `"level":"info"`)
+	require.NotContains(t, string(buf.Bytes()), `"level":"error"`)
+}
+
+func TestNewSignalGroupErrorReason(t *testing.T) {
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	ctx, group := NewSignalGroup(logger.WithContext(context.Background()))
+	errDatabase := errors.New("database connection lost")
+	group.Go(func() error {
+		return errDatabase
+	})
+	group.Go(func() error {
+		<-ctx.Done()
+		return nil
+	})
+
+	require.ErrorIs(t, group.Wait(), errDatabase)
+	require.Eventually(t, func() bool {
+		return bytes.Contains(buf.Bytes(), []byte(`"shutdownReason":"error"`)) &&
+			bytes.Contains(buf.Bytes(), []byte(`"error":"database connection lost"`))
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestNewSignalGroupShutdownDelay(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	var drain DrainState
+	ctx, group := NewSignalGroup(context.Background(), WithShutdownDelay(delay), WithDrainState(&drain))
+	group.Go(func() error {
+		<-ctx.Done()
+		return nil
+	})
+	require.NoError(t, drain.ReadinessCheck(ctx))
+
+	start := time.Now()
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	require.Eventually(t, drain.Draining, time.Second, time.Millisecond)
+	// The context is still active while draining, so servers keep serving.
+	require.NoError(t, ctx.Err())
+	require.ErrorIs(t, drain.ReadinessCheck(ctx), ErrDraining)
+
+	require.NoError(t, group.Wait())
+	require.GreaterOrEqual(t, time.Since(start), delay)
+	var signalErr SignalError
+	require.ErrorAs(t, context.Cause(ctx), &signalErr)
+}
+
+func TestShutdownDelayReadinessProbe(t *testing.T) {
+	var drain DrainState
+	ctx, group := NewSignalGroup(context.Background(), WithShutdownDelay(100*time.Millisecond), WithDrainState(&drain))
+	group.Go(func() error {
+		<-ctx.Done()
+		return nil
+	})
+	mux := monserver.NewMonitoringServer(nil, false, monserver.WithReadinessCheck("shutdown", drain.ReadinessCheck))
+	probe := func() int {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/ready", nil))
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, probe())
+
+	require.NoError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	// The probe fails during the delay while the context, and so the servers, are still running.
+	require.Eventually(t, func() bool { return probe() == http.StatusServiceUnavailable }, time.Second, time.Millisecond)
+	require.NoError(t, ctx.Err())
+
+	require.NoError(t, group.Wait())
+}
+
+// fakeGRPCServer accepts connections on its listener until it is stopped.
+type fakeGRPCServer struct {
+	lis net.Listener
+}
+
+func (s *fakeGRPCServer) Serve(lis net.Listener) error {
+	for {
+		conn, err := lis.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		_ = conn.Close()
+	}
+}
+
+func (s *fakeGRPCServer) GracefulStop() {
+	_ = s.lis.Close()
+}
+
+func TestRunListenerReturnsAddr(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	group, ctx := errgroup.WithContext(ctx)
+
+	httpLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpAddr := RunHandlerListener(ctx, group, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}), httpLis)
+
+	grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcAddr := RunGRPCListener(ctx, group, &fakeGRPCServer{lis: grpcLis}, grpcLis)
+
+	require.NotEqual(t, 0, httpAddr.(*net.TCPAddr).Port)
+	resp, err := http.Get("http://" + httpAddr.String())
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusTeapot, resp.StatusCode)
+
+	conn, err := net.Dial("tcp", grpcAddr.String())
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	cancel()
+	require.NoError(t, group.Wait())
+}
+
+// bindOnlyFiberApp listens on the address like fiber.App.Listen but does not serve.
+type bindOnlyFiberApp struct{}
+
+func (bindOnlyFiberApp) Listen(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return lis.Close()
+}
+
+func (bindOnlyFiberApp) Shutdown() error {
+	return nil
+}
+
+func TestRunBindFailed(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+	addr := lis.Addr().String()
+	// the fake gRPC server closes its listener when it is stopped, it must not be the bound one
+	grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		run  func(ctx context.Context, group *errgroup.Group)
+	}{
+		{name: "handler", run: func(ctx context.Context, group *errgroup.Group) {
+			RunHandler(ctx, group, http.NotFoundHandler(), addr)
+		}},
+		{name: "grpc", run: func(ctx context.Context, group *errgroup.Group) {
+			RunGRPC(ctx, group, &fakeGRPCServer{lis: grpcLis}, addr)
+		}},
+		{name: "fiber", run: func(ctx context.Context, group *errgroup.Group) {
+			RunFiber(ctx, group, bindOnlyFiberApp{}, addr)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group, ctx := errgroup.WithContext(context.Background())
+			tt.run(ctx, group)
+			err := group.Wait()
+			require.ErrorIs(t, err, ErrBindFailed)
+			require.ErrorIs(t, err, syscall.EADDRINUSE)
+		})
+	}
+}
+
+func TestRunLogsFailedServer(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = lis.Close() })
+	addr := lis.Addr().String()
+	grpcLis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	var buf syncBuffer
+	logger := zerolog.New(&buf)
+	group, ctx := errgroup.WithContext(logger.WithContext(context.Background()))
+	// the HTTP server fails to bind, the gRPC server is shut down because of it
+	RunHandler(ctx, group, http.NotFoundHandler(), addr)
+	RunGRPCListener(ctx, group, &fakeGRPCServer{lis: grpcLis}, grpcLis)
+	require.ErrorIs(t, group.Wait(), ErrBindFailed)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 1)
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &entry))
+	require.Equal(t, "error", entry["level"])
+	require.Equal(t, "Server failed", entry["message"])
+	require.Equal(t, KindHTTP, entry["serverKind"])
+	require.Equal(t, addr, entry["serverAddr"])
+	require.Contains(t, entry["error"], "address already in use")
+}
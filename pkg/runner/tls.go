@@ -0,0 +1,58 @@
+package runner
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// MTLSConfig configures mutual TLS for service to service traffic.
+type MTLSConfig struct {
+	// CertFile is the path of the PEM encoded server certificate.
+	CertFile string
+	// KeyFile is the path of the PEM encoded server private key.
+	KeyFile string
+	// ClientCAFile is the path of the PEM encoded CA certificates used to verify client certificates.
+	ClientCAFile string
+}
+
+// TLSConfig loads the certificates and returns a tls.Config that requires and verifies client certificates.
+// The config can also be used for gRPC servers with credentials.NewTLS.
+func (c MTLSConfig) TLSConfig() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+	caPEM, err := os.ReadFile(c.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA file: %w", err)
+	}
+	clientCAs := x509.NewCertPool()
+	if !clientCAs.AppendCertsFromPEM(caPEM) {
+		return nil, fmt.Errorf("no certificates found in client CA file %s", c.ClientCAFile)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    clientCAs,
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// RunHandlerTLS starts a HTTPS server with the given TLS config in a new goroutine and shuts it down when the context is cancelled.
+// Use MTLSConfig.TLSConfig to require and verify client certificates.
+func RunHandlerTLS(ctx context.Context, group *errgroup.Group, handler http.Handler, addr string, tlsConfig *tls.Config, opts ...RunOption) {
+	srv := &http.Server{
+		Addr:      addr,
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+	}
+	// the certificates are read from the TLS config
+	serve := func() error { return srv.ListenAndServeTLS("", "") }
+	runHTTPServer(ctx, group, srv, serve, ctx, newLifecycle(KindHTTP, opts))
+}
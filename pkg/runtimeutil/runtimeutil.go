@@ -0,0 +1,97 @@
+// Package runtimeutil provides helpers to tune the Go runtime for the environment the service runs in.
+package runtimeutil
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// cgroupRoot is the mount point of the cgroup filesystem.
+var cgroupRoot = "/sys/fs/cgroup"
+
+// AdjustMaxProcs restores the default GOMAXPROCS of the runtime and logs the chosen value with the CPU limit
+// of the container read from the cgroup CPU quota. It returns the resulting GOMAXPROCS.
+// Since Go 1.25 the runtime derives the default from the cgroup limit, rounding fractional limits up, and
+// updates it when the limit changes, so this undoes a manual runtime.GOMAXPROCS call, which disables the updates.
+// GOMAXPROCS is left unchanged when the GOMAXPROCS environment variable is set.
+func AdjustMaxProcs(logger *zerolog.Logger) int {
+	if logger == nil {
+		logger = zerolog.DefaultContextLogger
+	}
+	if logger == nil {
+		nop := zerolog.Nop()
+		logger = &nop
+	}
+	current := runtime.GOMAXPROCS(0)
+	if env, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		logger.Info().Int("gomaxprocs", current).Str("reason", "GOMAXPROCS environment variable set to "+env).Msg("GOMAXPROCS not adjusted")
+		return current
+	}
+	runtime.SetDefaultGOMAXPROCS()
+	procs := runtime.GOMAXPROCS(0)
+	event := logger.Info().Int("gomaxprocs", procs).Int("previousGomaxprocs", current)
+	if quota, err := cpuQuota(cgroupRoot); err == nil {
+		event = event.Float64("cpuQuota", quota)
+	} else {
+		event = event.AnErr("cpuQuotaError", err)
+	}
+	event.Msg("GOMAXPROCS set to the runtime default")
+	return procs
+}
+
+// errNoCPULimit is returned by cpuQuota when no CPU limit is configured.
+var errNoCPULimit = errors.New("no CPU limit configured")
+
+// cpuQuota returns the CPU limit in number of CPUs from the cgroup v2 cpu.max file
+// or, if it does not exist, the cgroup v1 CFS quota and period files.
+func cpuQuota(root string) (float64, error) {
+	data, err := os.ReadFile(filepath.Join(root, "cpu.max"))
+	if err == nil {
+		fields := strings.Fields(string(data))
+		if len(fields) != 2 {
+			return 0, fmt.Errorf("invalid cpu.max content %q", data)
+		}
+		if fields[0] == "max" {
+			return 0, errNoCPULimit
+		}
+		return parseQuota(fields[0], fields[1])
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return 0, fmt.Errorf("failed to read cpu.max: %w", err)
+	}
+
+	quota, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cpu.cfs_quota_us: %w", err)
+	}
+	period, err := os.ReadFile(filepath.Join(root, "cpu", "cpu.cfs_period_us"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read cpu.cfs_period_us: %w", err)
+	}
+	if strings.TrimSpace(string(quota)) == "-1" {
+		return 0, errNoCPULimit
+	}
+	return parseQuota(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+func parseQuota(quotaStr, periodStr string) (float64, error) {
+	quota, err := strconv.ParseFloat(quotaStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse CPU quota: %w", err)
+	}
+	period, err := strconv.ParseFloat(periodStr, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse CPU period: %w", err)
+	}
+	if quota <= 0 || period <= 0 {
+		return 0, errNoCPULimit
+	}
+	return quota / period, nil
+}
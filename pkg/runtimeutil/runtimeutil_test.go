@@ -0,0 +1,97 @@
+package runtimeutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdjustMaxProcs(t *testing.T) {
+	prevProcs := runtime.GOMAXPROCS(0)
+	prevRoot := cgroupRoot
+	t.Cleanup(func() {
+		runtime.GOMAXPROCS(prevProcs)
+		cgroupRoot = prevRoot
+	})
+	if _, ok := os.LookupEnv("GOMAXPROCS"); ok {
+		t.Skip("GOMAXPROCS environment variable is set")
+	}
+
+	cgroupRoot = t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(cgroupRoot, "cpu.max"), []byte("250000 100000\n"), 0o600))
+
+	runtime.SetDefaultGOMAXPROCS()
+	defaultProcs := runtime.GOMAXPROCS(0)
+	// A manual setting is undone.
+	runtime.GOMAXPROCS(defaultProcs + 1)
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	require.Equal(t, defaultProcs, AdjustMaxProcs(&logger))
+	require.Equal(t, defaultProcs, runtime.GOMAXPROCS(0))
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, float64(defaultProcs), entry["gomaxprocs"])
+	require.Equal(t, float64(defaultProcs+1), entry["previousGomaxprocs"])
+	// The fractional limit is logged as is.
+	require.Equal(t, 2.5, entry["cpuQuota"])
+}
+
+func TestCPUQuota(t *testing.T) {
+	tests := []struct {
+		name     string
+		files    map[string]string
+		expected float64
+		wantErr  bool
+	}{
+		{
+			name:     "cgroup v2 limit",
+			files:    map[string]string{"cpu.max": "50000 100000"},
+			expected: 0.5,
+		},
+		{
+			name:    "cgroup v2 no limit",
+			files:   map[string]string{"cpu.max": "max 100000"},
+			wantErr: true,
+		},
+		{
+			name:     "cgroup v1 limit",
+			files:    map[string]string{"cpu/cpu.cfs_quota_us": "400000", "cpu/cpu.cfs_period_us": "100000"},
+			expected: 4,
+		},
+		{
+			name:    "cgroup v1 no limit",
+			files:   map[string]string{"cpu/cpu.cfs_quota_us": "-1", "cpu/cpu.cfs_period_us": "100000"},
+			wantErr: true,
+		},
+		{
+			name:    "no cgroup files",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			for name, content := range tt.files {
+				path := filepath.Join(root, name)
+				require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o700))
+				require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			}
+			quota, err := cpuQuota(root)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.InDelta(t, tt.expected, quota, 0.001)
+		})
+	}
+}